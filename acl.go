@@ -0,0 +1,186 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	ACLField      = "ACL"   // 对象中保存权限的字段名
+	ACLPublic     = "*"     // 所有人
+	ACLRolePrefix = "role:" // 角色权限的前缀, 如 "role:admin"
+)
+
+// 单个用户, 角色或所有人的权限
+type ACLPermission struct {
+	Read  bool `json:"read,omitempty"`
+	Write bool `json:"write,omitempty"`
+}
+
+// 对象的读写权限, 键为 "*", 用户Id 或 "role:角色名". 编码为:
+//
+//	{"*":{"read":true},"5a1b...":{"read":true,"write":true},"role:admin":{"write":true}}
+type ACL map[string]ACLPermission
+
+func NewACL() ACL {
+	return make(ACL)
+}
+
+func (acl ACL) SetPublicReadAccess(allowed bool)  { acl.setRead(ACLPublic, allowed) }
+func (acl ACL) SetPublicWriteAccess(allowed bool) { acl.setWrite(ACLPublic, allowed) }
+
+func (acl ACL) SetReadAccess(userId string, allowed bool)  { acl.setRead(userId, allowed) }
+func (acl ACL) SetWriteAccess(userId string, allowed bool) { acl.setWrite(userId, allowed) }
+
+func (acl ACL) SetRoleReadAccess(role string, allowed bool) {
+	acl.setRead(ACLRolePrefix+role, allowed)
+}
+
+func (acl ACL) SetRoleWriteAccess(role string, allowed bool) {
+	acl.setWrite(ACLRolePrefix+role, allowed)
+}
+
+func (acl ACL) setRead(key string, allowed bool) {
+	p := acl[key]
+	p.Read = allowed
+	acl.set(key, p)
+}
+
+func (acl ACL) setWrite(key string, allowed bool) {
+	p := acl[key]
+	p.Write = allowed
+	acl.set(key, p)
+}
+
+func (acl ACL) set(key string, p ACLPermission) {
+	if !p.Read && !p.Write {
+		delete(acl, key)
+		return
+	}
+	acl[key] = p
+}
+
+// 判断 session 是否可读.
+// Master 总是可读; 没有设置 ACL 时所有人可读; 被禁用的用户只有公共权限
+func (acl ACL) CanRead(session CloudSession) bool {
+	return acl.allowed(session, func(p ACLPermission) bool { return p.Read })
+}
+
+// 判断 session 是否可写, 规则同 CanRead
+func (acl ACL) CanWrite(session CloudSession) bool {
+	return acl.allowed(session, func(p ACLPermission) bool { return p.Write })
+}
+
+func (acl ACL) allowed(session CloudSession, perm func(ACLPermission) bool) bool {
+	if session.Master || acl == nil {
+		return true
+	}
+	if perm(acl[ACLPublic]) {
+		return true
+	}
+	if session.Disabled || session.UserId == "" {
+		return false
+	}
+	if perm(acl[session.UserId]) {
+		return true
+	}
+	for _, role := range session.Roles {
+		if perm(acl[ACLRolePrefix+role]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查权限, 没有权限时返回 ErrCodeForbidden 错误
+func (acl ACL) Check(session CloudSession, write bool) error {
+	if write && !acl.CanWrite(session) {
+		return CloudError{Code: ErrCodeForbidden, Message: "没有写权限"}
+	}
+	if !write && !acl.CanRead(session) {
+		return CloudError{Code: ErrCodeForbidden, Message: "没有读权限"}
+	}
+	return nil
+}
+
+// 所有可读的用户Id, 角色名以 "role:" 开头
+func (acl ACL) Readers() []string {
+	var keys []string
+	for k, p := range acl {
+		if p.Read {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// 所有可写的用户Id, 角色名以 "role:" 开头
+func (acl ACL) Writers() []string {
+	var keys []string
+	for k, p := range acl {
+		if p.Write {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// 解析 ACL 字段的值, v 可以为 ACL 或解码后的 map. v 为 nil 时返回 nil ACL
+func ParseACL(v interface{}) (ACL, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case ACL:
+		return t, nil
+	case map[string]interface{}:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return nil, err
+		}
+		acl := make(ACL)
+		if err := json.Unmarshal(b, &acl); err != nil {
+			return nil, fmt.Errorf("ACL 格式错误: %v", err)
+		}
+		for k, p := range acl {
+			if k == "" || (strings.HasPrefix(k, ACLRolePrefix) && len(k) == len(ACLRolePrefix)) {
+				return nil, fmt.Errorf("ACL 键无效: %q", k)
+			}
+			acl.set(k, p)
+		}
+		return acl, nil
+	}
+	return nil, fmt.Errorf("ACL 格式错误: %T", v)
+}
+
+// 读取对象的 ACL
+func ObjectACL(obj map[string]interface{}) (ACL, error) {
+	return ParseACL(obj[ACLField])
+}
+
+// 客户端传入的 ACL
+func (req *CloudRequest) ACL() (ACL, error) {
+	return ObjectACL(req.Data)
+}
+
+// 更新/删除前对象的 ACL
+func (req *CloudRequest) PreviousACL() (ACL, error) {
+	return ObjectACL(req.Previous)
+}
+
+// 检查当前 Session 对更新/删除前的对象是否有写权限
+func (req *CloudRequest) CheckWrite() error {
+	acl, err := req.PreviousACL()
+	if err != nil {
+		return err
+	}
+	return acl.Check(req.Session, true)
+}
+
+// 在返回结果中设置对象的 ACL
+func (res *CloudeResponse) SetACL(acl ACL) {
+	if res.Data == nil {
+		res.Data = make(map[string]interface{})
+	}
+	res.Data[ACLField] = acl
+}
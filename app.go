@@ -0,0 +1,103 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// 应用运行环境
+const (
+	EnvDevelopment = "dev"
+	EnvStaging     = "staging"
+	EnvProduction  = "prod"
+)
+
+// 调用所属的应用
+type AppContext struct {
+
+	// 应用Id
+	AppId string `json:"appId"`
+
+	// 运行环境, 如 EnvProduction
+	Environment string `json:"environment"`
+
+	// 应用的配置, 由 API 服务器传入, 未传入时使用 Registry.Config
+	Config map[string]interface{} `json:"config,omitempty"`
+}
+
+// 读取字符串配置
+func (app AppContext) String(key string) string {
+	s, _ := app.Config[key].(string)
+	return s
+}
+
+// 多应用路由, 一个云代码服务可以同时为多个应用提供服务.
+// 每个应用(可按环境区分)有独立的 Registry, 调用按 CloudRequest.App 分发:
+// 先查找应用在该环境下的注册表, 没有时使用该应用不区分环境的注册表.
+type Router struct {
+	mu   sync.RWMutex
+	apps map[string]*Registry
+}
+
+func NewRouter() *Router {
+	return &Router{apps: make(map[string]*Registry)}
+}
+
+// 返回应用的注册表, 不存在时创建. env 为 "" 表示用于该应用的所有环境
+func (rt *Router) App(appId, env string) *Registry {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	key := appKey(appId, env)
+	r, ok := rt.apps[key]
+	if !ok {
+		r = NewRegistry()
+		rt.apps[key] = r
+	}
+	return r
+}
+
+// 查找处理该应用调用的注册表
+func (rt *Router) Registry(app AppContext) (*Registry, bool) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	if r, ok := rt.apps[appKey(app.AppId, app.Environment)]; ok && app.Environment != "" {
+		return r, true
+	}
+	r, ok := rt.apps[appKey(app.AppId, "")]
+	return r, ok
+}
+
+func (rt *Router) Call(ctx context.Context, name string, req *CloudRequest) *CloudeResponse {
+	r, ok := rt.Registry(req.App)
+	if !ok {
+		return unknownApp(req.App)
+	}
+	return r.Call(ctx, name, req)
+}
+
+func (rt *Router) RunHook(ctx context.Context, className string, hook HookType, req *CloudRequest) *CloudeResponse {
+	r, ok := rt.Registry(req.App)
+	if !ok {
+		return unknownApp(req.App)
+	}
+	return r.RunHook(ctx, className, hook, req)
+}
+
+func (rt *Router) Stream(ctx context.Context, name string, req *CloudRequest, w ResultWriter) *CloudeResponse {
+	r, ok := rt.Registry(req.App)
+	if !ok {
+		return unknownApp(req.App)
+	}
+	return r.Stream(ctx, name, req, w)
+}
+
+func appKey(appId, env string) string {
+	return appId + "\x00" + env
+}
+
+func unknownApp(app AppContext) *CloudeResponse {
+	return Fail(ErrCodeNotFound, fmt.Sprintf("应用不存在: %s (%s)", app.AppId, app.Environment))
+}
@@ -0,0 +1,224 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// 审计记录: 谁在什么时候修改了哪个对象, 以及修改前后的值
+type AuditRecord struct {
+	Time        string   `json:"time"`
+	AppId       string   `json:"appId,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	ClassName   string   `json:"className"`
+	ObjectId    string   `json:"objectId"`
+	Hook        HookType `json:"hook"`
+
+	// 操作用户, 以 Master Key 调用时可能为空
+	UserId string `json:"userId"`
+	Master bool   `json:"master"`
+
+	// 修改前的值(CloudRequest.Previous), 新建时为空
+	Before map[string]interface{} `json:"before,omitempty"`
+
+	// 修改后的值(CloudRequest.Data), 删除时为空
+	After map[string]interface{} `json:"after,omitempty"`
+
+	// 值有变化的顶层字段, 按名称排序
+	Changed []string `json:"changed,omitempty"`
+}
+
+// 审计记录的写入目标
+type AuditSink interface {
+	Write(ctx context.Context, rec *AuditRecord) error
+}
+
+// 以函数作为写入目标
+type AuditSinkFunc func(ctx context.Context, rec *AuditRecord) error
+
+func (fn AuditSinkFunc) Write(ctx context.Context, rec *AuditRecord) error {
+	return fn(ctx, rec)
+}
+
+// 每条记录写一行 JSON
+type JSONLAuditSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+func NewJSONLAuditSink(w io.Writer) *JSONLAuditSink {
+	return &JSONLAuditSink{w: w}
+}
+
+// 以追加方式打开文件
+func OpenJSONLAuditSink(path string) (*JSONLAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLAuditSink{w: f, closer: f}, nil
+}
+
+func (s *JSONLAuditSink) Write(ctx context.Context, rec *AuditRecord) error {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// 关闭由 OpenJSONLAuditSink 打开的文件
+func (s *JSONLAuditSink) Close() error {
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+// 保存在内存中, 用于测试
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+func (s *MemoryAuditSink) Write(ctx context.Context, rec *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, *rec)
+	return nil
+}
+
+// 已写入的记录
+func (s *MemoryAuditSink) Records() []AuditRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]AuditRecord(nil), s.records...)
+}
+
+// 审计, 通过 Registry.EnableAudit 为表开启:
+//
+//	auditor := types.NewAuditor(sink)
+//	registry.EnableAudit("Order", auditor)
+//
+// 开启后表的 afterSave 及 afterDelete 钩子成功执行时写入一条记录(没有处理函数时同样记录).
+// 钩子返回的 Hide、该表 beforeSave 钩子返回过的 Hide 及 Redact 所匹配的字段值以 Redacted 代替.
+// afterSave 及 afterDelete 一般不返回 Hide, beforeSave 隐藏的字段由 Registry 记住, 仅在当前进程内有效.
+type Auditor struct {
+	Sink AuditSink
+
+	// 总是遮盖的字段, 规则同 Hide
+	Redact []string
+
+	// 记录的钩子, 默认为 AfterSave 及 AfterDelete
+	Hooks []HookType
+}
+
+func NewAuditor(sink AuditSink) *Auditor {
+	return &Auditor{Sink: sink, Hooks: []HookType{AfterSave, AfterDelete}}
+}
+
+func (a *Auditor) audits(hook HookType) bool {
+	for _, h := range a.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
+// 由钩子的调用参数及执行结果生成记录并写入
+func (a *Auditor) Record(ctx context.Context, className string, hook HookType, req *CloudRequest, res *CloudeResponse) error {
+	return a.record(ctx, className, hook, req, res.Hide)
+}
+
+func (a *Auditor) record(ctx context.Context, className string, hook HookType, req *CloudRequest, hide []string) error {
+	patterns := append(append([]string(nil), a.Redact...), hide...)
+	rec := &AuditRecord{
+		Time:        ClockFrom(ctx).Now().UTC().Format(DateLayout),
+		AppId:       req.App.AppId,
+		Environment: req.App.Environment,
+		ClassName:   className,
+		ObjectId:    req.ObjectId,
+		Hook:        hook,
+		UserId:      req.Session.UserId,
+		Master:      req.Session.Master,
+		Before:      RedactFields(toJSONObject(req.Previous), patterns),
+	}
+	if hook != BeforeDelete && hook != AfterDelete {
+		rec.After = RedactFields(toJSONObject(req.Data), patterns)
+		rec.Changed = changedFields(req.Previous, req.Data)
+	}
+	if rec.ObjectId == "" {
+		if id, ok := req.Data["objectId"].(string); ok {
+			rec.ObjectId = id
+		}
+	}
+	return a.Sink.Write(ctx, rec)
+}
+
+// 转换为 JSON 中的值, 记录中不保留 Go 类型
+func toJSONObject(obj map[string]interface{}) map[string]interface{} {
+	if obj == nil {
+		return nil
+	}
+	m, _ := toJSONValue(obj).(map[string]interface{})
+	return m
+}
+
+func changedFields(before, after map[string]interface{}) []string {
+	var changed []string
+	for k, v := range after {
+		if prev, ok := before[k]; !ok || !sameValue(prev, v) {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// 为表开启审计, auditor 为 nil 时关闭
+func (r *Registry) EnableAudit(className string, auditor *Auditor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if auditor == nil {
+		delete(r.auditors, className)
+		return
+	}
+	r.auditors[className] = auditor
+}
+
+func (r *Registry) auditor(className string) *Auditor {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.auditors[className]
+}
+
+// 记住开启了审计的表 beforeSave 钩子返回的 Hide
+func (r *Registry) rememberHide(className string, hide []string) {
+	if len(hide) == 0 || r.auditor(className) == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hides[className] = unionStrings(r.hides[className], hide)
+}
+
+// 审计时需要遮盖的字段: 表 beforeSave 返回过的 Hide 与本次钩子返回的 Hide
+func (r *Registry) auditHide(className string, res *CloudeResponse) []string {
+	r.mu.RLock()
+	hide := append([]string(nil), r.hides[className]...)
+	r.mu.RUnlock()
+	return unionStrings(hide, res.Hide)
+}
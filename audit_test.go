@@ -0,0 +1,33 @@
+package types
+
+import (
+	"context"
+	"testing"
+)
+
+// beforeSave 隐藏的字段在 afterSave 的审计记录中同样被遮盖
+func TestAuditRedactsBeforeSaveHide(t *testing.T) {
+	sink := NewMemoryAuditSink()
+	r := NewRegistry()
+	r.EnableAudit("User", NewAuditor(sink))
+	r.Hook("User", BeforeSave, func(ctx context.Context, req *CloudRequest) *CloudeResponse {
+		return &CloudeResponse{Successed: true, Hide: []string{"password"}}
+	})
+
+	data := map[string]interface{}{"objectId": "u1", "name": "tom", "password": "secret"}
+	if res := r.RunHook(context.Background(), "User", BeforeSave, &CloudRequest{Data: data}); !res.Successed {
+		t.Fatal(res.Errors)
+	}
+	if res := r.RunHook(context.Background(), "User", AfterSave, &CloudRequest{Data: data}); !res.Successed {
+		t.Fatal(res.Errors)
+	}
+
+	records := sink.Records()
+	if len(records) != 1 {
+		t.Fatalf("审计记录数为 %d, 应为 1", len(records))
+	}
+	after := records[0].After
+	if after["password"] != Redacted || after["name"] != "tom" {
+		t.Fatalf("afterSave 的记录应遮盖 password: %v", after)
+	}
+}
@@ -0,0 +1,246 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 云代码调用数据 API 时使用的请求头
+const (
+	HeaderMasterKey    = "X-Sky-Master-Key"    // Master Key, 云代码服务器调用数据 API 时必须带上
+	HeaderCloudSession = "X-Sky-Cloud-Session" // JSON 编码的 CloudSession, 数据 API 按此 Session 校验权限
+)
+
+// 数据 API 的读写接口, DataClient 及 MemoryStore.DataAPI 实现了此接口
+type DataAPI interface {
+	Find(ctx context.Context, q *Query) (*QueryResult, error)
+
+	// objectId 为空时创建对象, 返回对象的 objectId
+	Save(ctx context.Context, className, objectId string, data map[string]interface{}) (string, error)
+	Delete(ctx context.Context, className, objectId string) error
+}
+
+// 云代码回调数据 API 的客户端.
+// 默认以调用者的 CloudSession 身份访问, 需要越过权限检查时使用 AsMaster.
+type DataClient struct {
+
+	// 数据 API 地址, 如 https://api.skynology.com/1.0
+	BaseURL string
+
+	// Master Key
+	MasterKey string
+
+	// 访问数据 API 时使用的 Session
+	Session CloudSession
+
+	// 网络错误或服务器返回 5xx 时的重试次数, 创建对象及包含原子操作的保存不会重试
+	Retries int
+
+	// 首次重试前的等待时间, 之后每次加倍
+	RetryWait time.Duration
+
+	// 单次调用的超时时间, ctx 已有 deadline 时以较早者为准. 0 表示不限制
+	Timeout time.Duration
+
+	HTTPClient *http.Client
+}
+
+// 创建客户端, session 一般为 CloudRequest.Session
+func NewDataClient(baseURL, masterKey string, session CloudSession) *DataClient {
+	return &DataClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		MasterKey:  masterKey,
+		Session:    session,
+		Retries:    2,
+		RetryWait:  100 * time.Millisecond,
+		Timeout:    10 * time.Second,
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+// 创建以调用者 Session 访问数据 API 的客户端
+func (req *CloudRequest) DataClient(baseURL, masterKey string) *DataClient {
+	return NewDataClient(baseURL, masterKey, req.Session)
+}
+
+// 返回以 Master 权限访问的客户端副本
+func (c *DataClient) AsMaster() *DataClient {
+	m := *c
+	m.Session.Master = true
+	return &m
+}
+
+// 返回以指定用户身份访问的客户端副本, 见 CloudSession.AsUser.
+// userId 不是当前用户时 Session 为禁用状态, 需要启用时使用 WithSession
+func (c *DataClient) AsUser(userId string, roles ...string) *DataClient {
+	return c.WithSession(c.Session.AsUser(userId, roles...))
+}
+
+// 返回以指定 Session 访问的客户端副本
+func (c *DataClient) WithSession(session CloudSession) *DataClient {
+	s := *c
+	s.Session = session
+	return &s
+}
+
+// 读取单个对象
+func (c *DataClient) Get(ctx context.Context, className, objectId string) (map[string]interface{}, error) {
+	var obj map[string]interface{}
+	if err := c.do(ctx, "GET", objectPath(className, objectId), nil, nil, &obj); err != nil {
+		return nil, err
+	}
+	return DecodeData(obj), nil
+}
+
+// 保存对象, objectId 为空时创建新对象并返回其 objectId.
+// data 中可以包含原子操作及 Date, Pointer 等特殊类型
+func (c *DataClient) Save(ctx context.Context, className, objectId string, data map[string]interface{}) (string, error) {
+	if objectId == "" {
+		var res struct {
+			ObjectId string `json:"objectId"`
+		}
+		if err := c.do(ctx, "POST", classPath(className), nil, data, &res); err != nil {
+			return "", err
+		}
+		return res.ObjectId, nil
+	}
+	return objectId, c.do(ctx, "PUT", objectPath(className, objectId), nil, data, nil)
+}
+
+// 删除对象
+func (c *DataClient) Delete(ctx context.Context, className, objectId string) error {
+	return c.do(ctx, "DELETE", objectPath(className, objectId), nil, nil, nil)
+}
+
+// 查询对象
+func (c *DataClient) Find(ctx context.Context, q *Query) (*QueryResult, error) {
+	values, err := q.Values()
+	if err != nil {
+		return nil, err
+	}
+	var res QueryResult
+	if err := c.do(ctx, "GET", classPath(q.ClassName), values, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func classPath(className string) string {
+	return "/classes/" + url.PathEscape(className)
+}
+
+func objectPath(className, objectId string) string {
+	return classPath(className) + "/" + url.PathEscape(objectId)
+}
+
+func (c *DataClient) do(ctx context.Context, method, path string, query url.Values, body, out interface{}) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	session, err := json.Marshal(c.Session)
+	if err != nil {
+		return err
+	}
+	u := c.BaseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	retries := c.Retries
+	if method == "POST" || hasOperation(body) {
+		// 首次请求可能已经执行, 重试会重复创建对象或重复执行原子操作
+		retries = 0
+	}
+	wait := c.RetryWait
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = c.send(ctx, method, u, session, payload, out)
+		if err == nil || !retry || attempt >= retries {
+			return err
+		}
+		select {
+		case <-time.After(wait):
+			wait *= 2
+		case <-ctx.Done():
+			return CloudError{Code: ErrCodeTimeout, Message: ctx.Err().Error()}
+		}
+	}
+}
+
+func hasOperation(body interface{}) bool {
+	data, ok := body.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for _, v := range data {
+		if IsOperation(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// 发送一次请求, retry 表示出错时是否可以重试
+func (c *DataClient) send(ctx context.Context, method, u string, session, payload []byte, out interface{}) (retry bool, err error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderMasterKey, c.MasterKey)
+	req.Header.Set(HeaderCloudSession, string(session))
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, CloudError{Code: ErrCodeTimeout, Message: ctx.Err().Error()}
+		}
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return true, err
+	}
+	if resp.StatusCode >= 400 {
+		var cerr CloudError
+		if json.Unmarshal(data, &cerr) != nil || cerr.Code == 0 {
+			cerr = CloudError{Code: ErrCodeInternal, Message: fmt.Sprintf("%s %s: %s", method, u, resp.Status)}
+		}
+		return resp.StatusCode >= 500, cerr
+	}
+	if out != nil && len(data) > 0 {
+		if err := json.Unmarshal(data, out); err != nil {
+			return false, CloudError{Code: ErrCodeInvalidJSON, Message: err.Error()}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,353 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"go/token"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const typesImportPath = "github.com/skynology/cloud-types"
+
+// 生成客户端代码的选项
+type ClientOptions struct {
+
+	// 生成代码的包名
+	Package string
+
+	// 生成代码所在包的导入路径, 该包中的类型不加包名. 可为空
+	PackagePath string
+
+	// 客户端类型名, 默认为 Client
+	TypeName string
+}
+
+// 根据注册表中云函数的说明(见 FunctionSpec)生成强类型的 Go 客户端代码.
+// 每个云函数生成一个方法, 参数和返回值为 Params 和 Result 的类型, 类型不一致时在编译期即可发现.
+// 没有说明的云函数不生成方法.
+//
+// 由于需要参数和返回值的类型信息, 生成器以一个小程序的方式运行:
+//
+//	//go:generate go run ./gen
+//
+//	func main() {
+//		registry := types.NewRegistry()
+//		cloud.Register(registry) // 定义云函数并调用 Describe
+//		f, _ := os.Create("orderclient/client.go")
+//		defer f.Close()
+//		if err := types.GenerateClient(f, registry, types.ClientOptions{Package: "orderclient"}); err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// 生成的客户端基于 Handler, 可以使用 StdioClient, WebSocketClient, 也可以直接使用 Registry.
+func GenerateClient(w io.Writer, r *Registry, opts ClientOptions) error {
+	if opts.Package == "" {
+		return fmt.Errorf("未指定包名")
+	}
+	if opts.TypeName == "" {
+		opts.TypeName = "Client"
+	}
+	if err := r.checkSpecs(); err != nil {
+		return err
+	}
+	g := &clientGen{opts: opts, imports: map[string]string{}, aliases: map[string]bool{}}
+	g.importAs(typesImportPath, "types")
+
+	methods := map[string]string{}
+	var body bytes.Buffer
+	for _, name := range r.FunctionNames() {
+		spec, ok := r.Spec(name)
+		if !ok {
+			continue
+		}
+		method := exportedName(name)
+		if method == "" {
+			return fmt.Errorf("云函数名无法转换为方法名: %q", name)
+		}
+		if other, dup := methods[method]; dup {
+			return fmt.Errorf("云函数 %q 与 %q 的方法名相同: %s", name, other, method)
+		}
+		methods[method] = name
+
+		_, stream := r.StreamFunction(name)
+		if err := g.method(&body, name, method, spec, stream); err != nil {
+			return fmt.Errorf("云函数 %q: %v", name, err)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by cloud-types GenerateClient. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&out, "package %s\n\n", opts.Package)
+	out.WriteString("import (\n")
+	paths := make([]string, 0, len(g.imports))
+	for path := range g.imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		// 标准库按包名导入, 其他包的包名不一定与路径一致, 总是指定别名
+		alias := g.imports[path]
+		if !strings.Contains(strings.Split(path, "/")[0], ".") && alias == path[strings.LastIndex(path, "/")+1:] {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		} else {
+			fmt.Fprintf(&out, "\t%s %q\n", alias, path)
+		}
+	}
+	out.WriteString(")\n\n")
+	fmt.Fprintf(&out, "// 云函数客户端\n")
+	fmt.Fprintf(&out, "type %s struct {\n\tHandler types.Handler\n}\n\n", opts.TypeName)
+	fmt.Fprintf(&out, "func New%s(h types.Handler) *%s {\n\treturn &%s{Handler: h}\n}\n\n", strings.TrimPrefix(opts.TypeName, "Client"), opts.TypeName, opts.TypeName)
+	out.Write(body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("生成的代码格式有误: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+type clientGen struct {
+	opts    ClientOptions
+	imports map[string]string // 导入路径 -> 包名
+	aliases map[string]bool
+}
+
+func (g *clientGen) method(w io.Writer, name, method string, spec FunctionSpec, stream bool) error {
+	// 只在生成了方法时导入, 没有云函数时生成的代码也能编译
+	g.importAs("context", "context")
+	var params, result string
+	var err error
+	if spec.Params != nil {
+		if params, err = g.typeExpr(reflect.TypeOf(spec.Params)); err != nil {
+			return err
+		}
+	}
+	if spec.Result != nil {
+		if result, err = g.typeExpr(reflect.TypeOf(spec.Result)); err != nil {
+			return err
+		}
+	}
+
+	comment := spec.Summary
+	if comment == "" {
+		comment = "调用云函数 " + name
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		fmt.Fprintf(w, "// %s\n", line)
+	}
+
+	args := "ctx context.Context, req *types.CloudRequest"
+	paramsArg := "nil"
+	if params != "" {
+		args += ", params " + params
+		paramsArg = "params"
+	}
+
+	if stream {
+		item := result
+		if item == "" {
+			item = "json.RawMessage"
+		}
+		g.importAs("encoding/json", "json")
+		fmt.Fprintf(w, "// 流式云函数, 每条结果调用一次 fn\n")
+		fmt.Fprintf(w, "func (c *%s) %s(%s, fn func(item %s) error) error {\n", g.opts.TypeName, method, args, item)
+		fmt.Fprintf(w, "\treturn types.StreamFunction(ctx, c.Handler, %q, req, %s, func(raw json.RawMessage) error {\n", name, paramsArg)
+		fmt.Fprintf(w, "\t\tvar item %s\n", item)
+		fmt.Fprintf(w, "\t\tif err := json.Unmarshal(raw, &item); err != nil {\n\t\t\treturn err\n\t\t}\n")
+		fmt.Fprintf(w, "\t\treturn fn(item)\n\t})\n}\n\n")
+		return nil
+	}
+
+	if result == "" {
+		fmt.Fprintf(w, "func (c *%s) %s(%s) error {\n", g.opts.TypeName, method, args)
+		fmt.Fprintf(w, "\treturn types.CallFunction(ctx, c.Handler, %q, req, %s, nil)\n}\n\n", name, paramsArg)
+		return nil
+	}
+	fmt.Fprintf(w, "func (c *%s) %s(%s) (%s, error) {\n", g.opts.TypeName, method, args, result)
+	fmt.Fprintf(w, "\tvar result %s\n", result)
+	fmt.Fprintf(w, "\terr := types.CallFunction(ctx, c.Handler, %q, req, %s, &result)\n", name, paramsArg)
+	fmt.Fprintf(w, "\treturn result, err\n}\n\n")
+	return nil
+}
+
+// 生成类型表达式, 按需添加导入
+func (g *clientGen) typeExpr(t reflect.Type) (string, error) {
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			return t.Name(), nil
+		}
+		if t.PkgPath() == g.opts.PackagePath {
+			return t.Name(), nil
+		}
+		if t.PkgPath() == "main" {
+			return "", fmt.Errorf("类型 %s 定义在 main 包中, 无法导入", t)
+		}
+		if !token.IsExported(t.Name()) {
+			return "", fmt.Errorf("类型 %s 未导出", t)
+		}
+		return g.importPath(t.PkgPath()) + "." + t.Name(), nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem, err := g.typeExpr(t.Elem())
+		return "*" + elem, err
+	case reflect.Slice:
+		elem, err := g.typeExpr(t.Elem())
+		return "[]" + elem, err
+	case reflect.Array:
+		elem, err := g.typeExpr(t.Elem())
+		return "[" + strconv.Itoa(t.Len()) + "]" + elem, err
+	case reflect.Map:
+		key, err := g.typeExpr(t.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.typeExpr(t.Elem())
+		return "map[" + key + "]" + elem, err
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			return "interface{}", nil
+		}
+	}
+	return "", fmt.Errorf("不支持匿名类型 %s, 请定义为具名类型", t)
+}
+
+func (g *clientGen) importPath(path string) string {
+	if alias, ok := g.imports[path]; ok {
+		return alias
+	}
+	base := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return '_'
+	}, path[strings.LastIndex(path, "/")+1:])
+	alias := base
+	for i := 2; g.aliases[alias] || reservedName(alias); i++ {
+		alias = base + strconv.Itoa(i)
+	}
+	g.importAs(path, alias)
+	return alias
+}
+
+// 生成代码中已使用的标识符
+func reservedName(name string) bool {
+	switch name {
+	case "c", "ctx", "req", "params", "fn", "item", "raw", "result", "err":
+		return true
+	}
+	return token.Lookup(name).IsKeyword()
+}
+
+func (g *clientGen) importAs(path, alias string) {
+	g.imports[path] = alias
+	g.aliases[alias] = true
+}
+
+// 云函数名转换为导出的方法名, 如 createOrder -> CreateOrder, order.create -> OrderCreate
+func exportedName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			return ""
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// 以 params 作为 Data 调用云函数, 成功时将 Result 解码到 result, 失败时返回 CloudError.
+// 生成的客户端代码使用此函数, req 可为 nil, 不会被修改
+func CallFunction(ctx context.Context, h Handler, name string, req *CloudRequest, params, result interface{}) error {
+	call, err := functionRequest(req, params)
+	if err != nil {
+		return err
+	}
+	res := h.Call(ctx, name, call)
+	if !res.Successed {
+		return res.Errors
+	}
+	if result == nil || res.Result == nil {
+		return nil
+	}
+	b, err := json.Marshal(res.Result)
+	if err == nil {
+		err = json.Unmarshal(b, result)
+	}
+	if err != nil {
+		return &ResultTypeError{Type: reflect.TypeOf(result).Elem(), Err: err}
+	}
+	return nil
+}
+
+// 流式调用云函数, 每条结果调用一次 fn. h 不支持流式调用时以普通方式调用, 再逐条处理数组结果
+func StreamFunction(ctx context.Context, h Handler, name string, req *CloudRequest, params interface{}, fn func(item json.RawMessage) error) error {
+	call, err := functionRequest(req, params)
+	if err != nil {
+		return err
+	}
+	var res *CloudeResponse
+	if sh, ok := h.(StreamHandler); ok {
+		res = sh.Stream(ctx, name, call, rawItemWriter(fn))
+	} else {
+		res = h.Call(ctx, name, call)
+		if res.Successed {
+			if err := writeResult(rawItemWriter(fn), res.Result); err != nil {
+				return err
+			}
+		}
+	}
+	if !res.Successed {
+		return res.Errors
+	}
+	return nil
+}
+
+type rawItemWriter func(item json.RawMessage) error
+
+func (fn rawItemWriter) Write(item interface{}) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return fn(b)
+}
+
+func functionRequest(req *CloudRequest, params interface{}) (*CloudRequest, error) {
+	call := &CloudRequest{}
+	if req != nil {
+		copied := *req
+		call = &copied
+	}
+	if params != nil {
+		b, err := json.Marshal(params)
+		if err != nil {
+			return nil, err
+		}
+		var data map[string]interface{}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return nil, fmt.Errorf("参数必须编码为 JSON 对象: %v", err)
+		}
+		call.Data = data
+	}
+	return call, nil
+}
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"bytes"
+	"context"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"testing"
+)
+
+// 从源码导入, 各测试共用以免重复解析
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// 类型检查生成的客户端, 未使用的导入同样报错
+func checkGeneratedClient(t *testing.T, r *Registry) {
+	var buf bytes.Buffer
+	if err := GenerateClient(&buf, r, ClientOptions{Package: "client"}); err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "client.go", buf.Bytes(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := gotypes.Config{Importer: sourceImporter}
+	if _, err := conf.Check("client", fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("生成的代码无法编译: %v\n%s", err, buf.Bytes())
+	}
+}
+
+func TestGenerateClientEmpty(t *testing.T) {
+	checkGeneratedClient(t, NewRegistry())
+}
+
+func TestGenerateClient(t *testing.T) {
+	r := NewRegistry()
+	r.Define("hello", func(ctx context.Context, req *CloudRequest) *CloudeResponse { return nil })
+	r.Describe("hello", FunctionSpec{Summary: "问候", Result: ""})
+	checkGeneratedClient(t, r)
+}
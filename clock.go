@@ -0,0 +1,88 @@
+package types
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 时钟, 云代码运行时取当前时间都通过它, 测试时可替换为 FakeClock 以得到可重现的结果
+type Clock interface {
+	Now() time.Time
+}
+
+// 系统时钟
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// 手动控制的时钟, 用于测试. 只有调用 Set 或 Advance 时时间才会改变
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// 设置当前时间
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+// 时间前进 d
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type clockKey struct{}
+
+// 返回带有时钟的 ctx, Registry 设置了 Clock 时会在调用前放入
+func WithClock(ctx context.Context, c Clock) context.Context {
+	return context.WithValue(ctx, clockKey{}, c)
+}
+
+// 读取 ctx 中的时钟, 没有时返回 SystemClock
+func ClockFrom(ctx context.Context) Clock {
+	if ctx != nil {
+		if c, ok := ctx.Value(clockKey{}).(Clock); ok && c != nil {
+			return c
+		}
+	}
+	return SystemClock
+}
+
+// 字段未设置时使用系统时钟
+func clockOrSystem(c Clock) Clock {
+	if c == nil {
+		return SystemClock
+	}
+	return c
+}
+
+// 创建一条调试日志, CreatedAt 取自 ctx 中的时钟
+func NewLog(ctx context.Context, flag, content string) CloudLog {
+	return CloudLog{
+		CreatedAt: ClockFrom(ctx).Now().UTC().Format(DateLayout),
+		Content:   content,
+		Flag:      flag,
+	}
+}
+
+// 添加一条调试日志
+func (res *CloudeResponse) AddLog(ctx context.Context, flag, content string) {
+	res.Logs = append(res.Logs, NewLog(ctx, flag, content))
+}
@@ -0,0 +1,233 @@
+package types
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 死信类型
+const (
+	DeadLetterHook  = "hook"  // afterSave/afterDelete 钩子的处理函数
+	DeadLetterEvent = "event" // 事件总线的订阅者
+)
+
+// 重试后仍然失败的调用, 保存原始的 CloudRequest 以便检查及重放
+type DeadLetter struct {
+	Id   string `json:"id"`
+	Kind string `json:"kind"`
+
+	// 失败的处理函数, 如 "Order.afterSave#1" 表示 Order 表 afterSave 的第 2 个处理函数(或订阅者).
+	// 序号按注册顺序计算, 重放前需要以相同顺序注册
+	Handler string `json:"handler"`
+
+	ClassName string       `json:"className"`
+	Hook      HookType     `json:"hook"`
+	Request   CloudRequest `json:"request"`
+
+	// 最后一次失败的原因
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// 死信存储, 可自行实现(如数据库)
+type DeadLetterStore interface {
+	Add(dl *DeadLetter) error
+	Get(id string) (*DeadLetter, error)
+
+	// 所有死信, 按失败时间排序
+	List() ([]*DeadLetter, error)
+	Remove(id string) error
+}
+
+func newDeadLetterId() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func handlerName(key string, index int) string {
+	return fmt.Sprintf("%s#%d", key, index)
+}
+
+func parseHandlerName(name string) (key string, index int, err error) {
+	i := strings.LastIndex(name, "#")
+	if i < 0 {
+		return "", 0, fmt.Errorf("无效的处理函数: %q", name)
+	}
+	if _, err := fmt.Sscan(name[i+1:], &index); err != nil {
+		return "", 0, fmt.Errorf("无效的处理函数: %q", name)
+	}
+	return name[:i], index, nil
+}
+
+func deadLetterNotFound(id string) error {
+	return CloudError{Code: ErrCodeNotFound, Message: fmt.Sprintf("死信不存在: %s", id)}
+}
+
+// 内存中的死信存储, 用于测试
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	letters map[string]*DeadLetter
+}
+
+func NewMemoryDeadLetterStore() *MemoryDeadLetterStore {
+	return &MemoryDeadLetterStore{letters: make(map[string]*DeadLetter)}
+}
+
+func (s *MemoryDeadLetterStore) Add(dl *DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *dl
+	s.letters[dl.Id] = &copied
+	return nil
+}
+
+func (s *MemoryDeadLetterStore) Get(id string) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dl, ok := s.letters[id]
+	if !ok {
+		return nil, deadLetterNotFound(id)
+	}
+	copied := *dl
+	return &copied, nil
+}
+
+func (s *MemoryDeadLetterStore) List() ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*DeadLetter, 0, len(s.letters))
+	for _, dl := range s.letters {
+		copied := *dl
+		list = append(list, &copied)
+	}
+	sortDeadLetters(list)
+	return list, nil
+}
+
+func (s *MemoryDeadLetterStore) Remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.letters[id]; !ok {
+		return deadLetterNotFound(id)
+	}
+	delete(s.letters, id)
+	return nil
+}
+
+// 文件死信存储, 每条死信保存为目录下的一个 JSON 文件
+type FileDeadLetterStore struct {
+	Dir string
+}
+
+// 使用目录 dir, 不存在时创建
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetterStore{Dir: dir}, nil
+}
+
+func (s *FileDeadLetterStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", fmt.Errorf("无效的死信Id: %q", id)
+	}
+	return filepath.Join(s.Dir, id+".json"), nil
+}
+
+func (s *FileDeadLetterStore) Add(dl *DeadLetter) error {
+	p, err := s.path(dl.Id)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再改名, 避免留下不完整的文件
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (s *FileDeadLetterStore) Get(id string) (*DeadLetter, error) {
+	p, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, deadLetterNotFound(id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dl DeadLetter
+	if err := json.Unmarshal(b, &dl); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+func (s *FileDeadLetterStore) List() ([]*DeadLetter, error) {
+	names, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*DeadLetter, 0, len(names))
+	for _, name := range names {
+		dl, err := s.Get(strings.TrimSuffix(filepath.Base(name), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, dl)
+	}
+	sortDeadLetters(list)
+	return list, nil
+}
+
+func (s *FileDeadLetterStore) Remove(id string) error {
+	p, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return deadLetterNotFound(id)
+	}
+	return err
+}
+
+func sortDeadLetters(list []*DeadLetter) {
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].FailedAt.Equal(list[j].FailedAt) {
+			return list[i].FailedAt.Before(list[j].FailedAt)
+		}
+		return list[i].Id < list[j].Id
+	})
+}
+
+// 重放结果: 成功时从存储中删除, 失败时更新 Attempts 及 Error
+func finishReplay(store DeadLetterStore, dl *DeadLetter, err error, now time.Time) error {
+	if err == nil {
+		return store.Remove(dl.Id)
+	}
+	dl.Attempts++
+	dl.Error = err.Error()
+	dl.FailedAt = now
+	if addErr := store.Add(dl); addErr != nil {
+		return addErr
+	}
+	return err
+}
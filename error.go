@@ -0,0 +1,36 @@
+package types
+
+// 云代码错误码
+const (
+	ErrCodeInternal     = 1   // 内部错误
+	ErrCodeNotFound     = 101 // 对象不存在
+	ErrCodeInvalidQuery = 102 // 查询参数错误
+	ErrCodeInvalidJSON  = 107 // JSON 格式错误
+	ErrCodeForbidden    = 119 // 没有操作权限
+	ErrCodeTimeout      = 124 // 调用超时或被取消
+	ErrCodeDuplicate    = 137 // 对象已存在
+	ErrCodeCloudFailure = 141 // 云代码执行失败
+	ErrCodeValidation   = 142 // 字段校验失败
+	ErrCodeReferenced   = 143 // 对象仍被引用
+)
+
+var errCodeText = map[int]string{
+	ErrCodeInternal:     "内部错误",
+	ErrCodeNotFound:     "对象不存在",
+	ErrCodeInvalidQuery: "查询参数错误",
+	ErrCodeInvalidJSON:  "JSON 格式错误",
+	ErrCodeForbidden:    "没有操作权限",
+	ErrCodeTimeout:      "调用超时或被取消",
+	ErrCodeDuplicate:    "对象已存在",
+	ErrCodeCloudFailure: "云代码执行失败",
+	ErrCodeValidation:   "字段校验失败",
+	ErrCodeReferenced:   "对象仍被引用",
+}
+
+// 创建一个失败的返回结构
+func Fail(code int, message string) *CloudeResponse {
+	return &CloudeResponse{
+		Successed: false,
+		Errors:    CloudError{Code: code, Message: message},
+	}
+}
@@ -0,0 +1,276 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// 领域事件, 由 afterSave 及 afterDelete 钩子的调用参数生成
+type Event struct {
+	ClassName string
+	Hook      HookType
+	ObjectId  string
+
+	App     AppContext
+	Session CloudSession
+
+	// 保存后的对象, 删除时为空
+	Data map[string]interface{}
+
+	// 修改前的对象
+	Previous map[string]interface{}
+
+	// 事件发生的时间, 取自 ctx 中的时钟
+	Time time.Time
+}
+
+// 由钩子的调用参数生成事件, Data 及 Previous 为副本
+func NewEvent(ctx context.Context, className string, hook HookType, req *CloudRequest) *Event {
+	ev := &Event{
+		ClassName: className,
+		Hook:      hook,
+		ObjectId:  hookObjectId(req),
+		App:       req.App,
+		Session:   req.Session,
+		Previous:  copyObject(req.Previous),
+		Time:      ClockFrom(ctx).Now(),
+	}
+	if hook != AfterDelete {
+		ev.Data = copyObject(req.Data)
+	}
+	return ev
+}
+
+// 生成事件的调用参数, 用于保存死信
+func (ev *Event) Request() CloudRequest {
+	return CloudRequest{
+		ObjectId: ev.ObjectId,
+		Data:     copyObject(ev.Data),
+		Session:  ev.Session,
+		App:      ev.App,
+		Previous: copyObject(ev.Previous),
+	}
+}
+
+// 将 Data 解码到结构体
+func (ev *Event) Bind(v interface{}) error {
+	return Bind(ev.Data, v)
+}
+
+// 将 Previous 解码到结构体
+func (ev *Event) BindPrevious(v interface{}) error {
+	return Bind(ev.Previous, v)
+}
+
+// 事件处理函数
+type EventHandler func(ctx context.Context, ev *Event) error
+
+var ErrEventBusClosed = errors.New("事件总线已关闭")
+
+// 进程内的事件总线.
+// 订阅者在固定数量的协程中异步执行, 同一对象(ClassName + ObjectId)的事件总是由同一协程按发布顺序处理.
+// 设置为 Registry.Events 后, afterSave 及 afterDelete 钩子成功执行时自动发布事件:
+//
+//	bus := types.NewEventBus(8)
+//	bus.Subscribe("Order", types.AfterSave, func(ctx context.Context, ev *types.Event) error {
+//		return sendTemplateMessage(ev)
+//	})
+//	registry.Events = bus
+type EventBus struct {
+
+	// 订阅者返回错误或 panic 时调用(重试后仍然失败时才调用), 为 nil 时忽略
+	OnError func(ev *Event, err error)
+
+	// 订阅者失败时的重试策略, 为 nil 时不重试. 重试期间同一协程中的后续事件等待
+	Retry *RetryPolicy
+
+	// 重试后仍然失败的事件保存于此, 可以用 Replay 重放. 为 nil 时不保存
+	DeadLetters DeadLetterStore
+
+	// 死信失败时间的时钟, 为 nil 时使用系统时钟
+	Clock Clock
+
+	hmu      sync.RWMutex
+	handlers map[string][]EventHandler
+
+	// 发布时持有读锁, 关闭时持有写锁
+	qmu    sync.RWMutex
+	queues []chan *Event
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// 创建事件总线, workers 为并发处理的协程数
+func NewEventBus(workers int) *EventBus {
+	return NewEventBusSize(workers, 256)
+}
+
+// 创建事件总线并指定每个协程的队列长度
+func NewEventBusSize(workers, queueSize int) *EventBus {
+	if workers <= 0 {
+		workers = 1
+	}
+	b := &EventBus{handlers: make(map[string][]EventHandler)}
+	for i := 0; i < workers; i++ {
+		q := make(chan *Event, queueSize)
+		b.queues = append(b.queues, q)
+		b.wg.Add(1)
+		go b.work(q)
+	}
+	return b
+}
+
+// 订阅表上的事件, className 为 "*" 时订阅所有表
+func (b *EventBus) Subscribe(className string, hook HookType, fn EventHandler) {
+	b.hmu.Lock()
+	defer b.hmu.Unlock()
+	key := hookKey(className, hook)
+	b.handlers[key] = append(b.handlers[key], fn)
+}
+
+// 发布事件, 队列已满时等待, 直到入队或 ctx 结束
+func (b *EventBus) Publish(ctx context.Context, ev *Event) error {
+	if len(b.subscribers(ev)) == 0 {
+		return nil
+	}
+	b.qmu.RLock()
+	defer b.qmu.RUnlock()
+	if b.closed {
+		return ErrEventBusClosed
+	}
+	h := fnv.New32a()
+	h.Write([]byte(ev.ClassName + "\x00" + ev.ObjectId))
+	q := b.queues[h.Sum32()%uint32(len(b.queues))]
+	select {
+	case q <- ev:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *EventBus) work(q chan *Event) {
+	defer b.wg.Done()
+	for ev := range q {
+		ctx := context.Background()
+		for _, sub := range b.subscribers(ev) {
+			b.deliver(ctx, sub, ev)
+		}
+	}
+}
+
+// 订阅者, 以所订阅的表及钩子和注册顺序标识
+type subscription struct {
+	key   string
+	index int
+	fn    EventHandler
+}
+
+func (b *EventBus) subscribers(ev *Event) []subscription {
+	b.hmu.RLock()
+	defer b.hmu.RUnlock()
+	var subs []subscription
+	for _, key := range []string{hookKey(ev.ClassName, ev.Hook), hookKey("*", ev.Hook)} {
+		for i, fn := range b.handlers[key] {
+			subs = append(subs, subscription{key: key, index: i, fn: fn})
+		}
+	}
+	return subs
+}
+
+func (b *EventBus) deliver(ctx context.Context, sub subscription, ev *Event) {
+	policy := RetryPolicy{Attempts: 1}
+	if b.Retry != nil {
+		policy = *b.Retry
+	}
+	attempts, err := policy.Do(ctx, func() error {
+		return callEventHandler(ctx, sub.fn, ev)
+	})
+	if err == nil {
+		return
+	}
+	if b.OnError != nil {
+		b.OnError(ev, err)
+	}
+	if b.DeadLetters != nil {
+		dl := &DeadLetter{
+			Id:        newDeadLetterId(),
+			Kind:      DeadLetterEvent,
+			Handler:   handlerName(sub.key, sub.index),
+			ClassName: ev.ClassName,
+			Hook:      ev.Hook,
+			Request:   ev.Request(),
+			Error:     err.Error(),
+			Attempts:  attempts,
+			FailedAt:  clockOrSystem(b.Clock).Now(),
+		}
+		if addErr := b.DeadLetters.Add(dl); addErr != nil && b.OnError != nil {
+			b.OnError(ev, fmt.Errorf("死信保存失败: %v", addErr))
+		}
+	}
+}
+
+// 重放 DeadLetters 中的死信: 只调用失败的那个订阅者, 不重试.
+// 成功后删除死信, 失败时更新死信的 Attempts 及 Error 并返回错误
+func (b *EventBus) Replay(ctx context.Context, id string) error {
+	if b.DeadLetters == nil {
+		return fmt.Errorf("未设置死信存储")
+	}
+	dl, err := b.DeadLetters.Get(id)
+	if err != nil {
+		return err
+	}
+	if dl.Kind != DeadLetterEvent {
+		return fmt.Errorf("死信 %s 不是事件", id)
+	}
+	key, index, err := parseHandlerName(dl.Handler)
+	if err != nil {
+		return err
+	}
+	b.hmu.RLock()
+	handlers := b.handlers[key]
+	b.hmu.RUnlock()
+	if index >= len(handlers) {
+		return fmt.Errorf("订阅者不存在: %s", dl.Handler)
+	}
+	ev := NewEvent(ctx, dl.ClassName, dl.Hook, &dl.Request)
+	err = callEventHandler(ctx, handlers[index], ev)
+	return finishReplay(b.DeadLetters, dl, err, ClockFrom(ctx).Now())
+}
+
+func callEventHandler(ctx context.Context, fn EventHandler, ev *Event) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("事件处理出错: %v", e)
+		}
+	}()
+	return fn(ctx, ev)
+}
+
+// 不再接收新的事件, 等待已发布的事件处理完成或 ctx 结束
+func (b *EventBus) Close(ctx context.Context) error {
+	b.qmu.Lock()
+	if !b.closed {
+		b.closed = true
+		for _, q := range b.queues {
+			close(q)
+		}
+	}
+	b.qmu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
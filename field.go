@@ -0,0 +1,344 @@
+package types
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 特殊字段类型, 编码为 {"__type": "Date", ...}
+const (
+	TypeDate     = "Date"
+	TypePointer  = "Pointer"
+	TypeFile     = "File"
+	TypeGeoPoint = "GeoPoint"
+	TypeBytes    = "Bytes"
+	TypeRelation = "Relation"
+)
+
+// 日期编码格式, UTC 毫秒精度
+const DateLayout = "2006-01-02T15:04:05.000Z"
+
+// 解析日期字符串时依次尝试的格式
+var dateLayouts = []string{
+	DateLayout,
+	time.RFC3339Nano,
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// 日期
+type Date struct {
+	time.Time
+}
+
+// 指向其他对象的引用
+type Pointer struct {
+	ClassName string `json:"className"`
+	ObjectId  string `json:"objectId"`
+}
+
+// 文件
+type File struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// 地理位置
+type GeoPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+// 二进制数据, 以 base64 编码传输
+type Bytes []byte
+
+// 多对多关系
+type Relation struct {
+	ClassName string `json:"className"`
+}
+
+func NewDate(t time.Time) Date {
+	return Date{Time: t}
+}
+
+func NewPointer(className, objectId string) *Pointer {
+	return &Pointer{ClassName: className, ObjectId: objectId}
+}
+
+// 解析日期, 支持 Date 编码, 多种格式的日期字符串及毫秒时间戳
+func ParseDate(v interface{}) (Date, error) {
+	switch t := v.(type) {
+	case Date:
+		return t, nil
+	case *Date:
+		if t == nil {
+			return Date{}, errors.New("日期为 nil")
+		}
+		return *t, nil
+	case time.Time:
+		return Date{Time: t}, nil
+	case map[string]interface{}:
+		if t["__type"] != TypeDate {
+			return Date{}, fmt.Errorf("不是日期类型: %v", t["__type"])
+		}
+		return ParseDate(t["iso"])
+	case string:
+		for _, layout := range dateLayouts {
+			if d, err := time.Parse(layout, t); err == nil {
+				return Date{Time: d}, nil
+			}
+		}
+		if ms, err := strconv.ParseInt(t, 10, 64); err == nil {
+			return Date{Time: time.Unix(0, ms*int64(time.Millisecond))}, nil
+		}
+		return Date{}, fmt.Errorf("无法解析日期: %q", t)
+	default:
+		if ms, ok := toFloat(v); ok {
+			return Date{Time: time.Unix(0, int64(ms)*int64(time.Millisecond))}, nil
+		}
+	}
+	return Date{}, fmt.Errorf("无法解析日期: %v", v)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"__type": TypeDate, "iso": d.UTC().Format(DateLayout)})
+}
+
+func (d *Date) UnmarshalJSON(b []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	parsed, err := ParseDate(v)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (p Pointer) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"__type": TypePointer, "className": p.ClassName, "objectId": p.ObjectId})
+}
+
+func (p *Pointer) UnmarshalJSON(b []byte) error {
+	type pointer Pointer
+	return unmarshalTyped(b, TypePointer, (*pointer)(p))
+}
+
+func (f File) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"__type": TypeFile, "name": f.Name, "url": f.URL})
+}
+
+func (f *File) UnmarshalJSON(b []byte) error {
+	type file File
+	return unmarshalTyped(b, TypeFile, (*file)(f))
+}
+
+func (g GeoPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"__type": TypeGeoPoint, "latitude": g.Latitude, "longitude": g.Longitude})
+}
+
+func (g *GeoPoint) UnmarshalJSON(b []byte) error {
+	type geoPoint GeoPoint
+	return unmarshalTyped(b, TypeGeoPoint, (*geoPoint)(g))
+}
+
+func (r Relation) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"__type": TypeRelation, "className": r.ClassName})
+}
+
+func (r *Relation) UnmarshalJSON(b []byte) error {
+	type relation Relation
+	return unmarshalTyped(b, TypeRelation, (*relation)(r))
+}
+
+func (bs Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]string{"__type": TypeBytes, "base64": base64.StdEncoding.EncodeToString(bs)})
+}
+
+func (bs *Bytes) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Type   string `json:"__type"`
+		Base64 string `json:"base64"`
+	}
+	if err := unmarshalTyped(b, TypeBytes, &v); err != nil {
+		return err
+	}
+	data, err := base64.StdEncoding.DecodeString(v.Base64)
+	if err != nil {
+		return err
+	}
+	*bs = data
+	return nil
+}
+
+// 解码带 __type 的 JSON 对象, 并检查类型是否一致
+func unmarshalTyped(b []byte, typ string, v interface{}) error {
+	var head struct {
+		Type string `json:"__type"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return err
+	}
+	if head.Type != typ {
+		return fmt.Errorf("类型不匹配, 应为 %s, 实际为 %q", typ, head.Type)
+	}
+	return json.Unmarshal(b, v)
+}
+
+// 将解码后的字段值中带 __type 的 map 转换为对应的 Go 类型, 数组及嵌套对象会递归转换.
+// 特殊类型统一转换为值(Date, Pointer, File, GeoPoint, Bytes, Relation), 已是指针(如 NewPointer 的返回)的也转换为值, nil 指针转换为 nil.
+// 无法识别的值原样返回
+func DecodeField(v interface{}) interface{} {
+	switch t := v.(type) {
+	case *Date:
+		return derefField(t)
+	case *Pointer:
+		return derefField(t)
+	case *File:
+		return derefField(t)
+	case *GeoPoint:
+		return derefField(t)
+	case *Relation:
+		return derefField(t)
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			list[i] = DecodeField(item)
+		}
+		return list
+	case map[string]interface{}:
+		typ, ok := t["__type"].(string)
+		if !ok {
+			return DecodeData(t)
+		}
+		if field, err := decodeTyped(typ, t); err == nil {
+			return field
+		}
+	}
+	return v
+}
+
+func derefField[T any](p *T) interface{} {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+// 转换 Data 或 Previous 中所有的特殊类型字段, 返回新的 map
+func DecodeData(data map[string]interface{}) map[string]interface{} {
+	if data == nil {
+		return nil
+	}
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		result[k] = DecodeField(v)
+	}
+	return result
+}
+
+func decodeTyped(typ string, m map[string]interface{}) (interface{}, error) {
+	if typ == TypeDate {
+		return ParseDate(m)
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case TypePointer:
+		var p Pointer
+		err = json.Unmarshal(b, &p)
+		return p, err
+	case TypeFile:
+		var f File
+		err = json.Unmarshal(b, &f)
+		return f, err
+	case TypeGeoPoint:
+		var g GeoPoint
+		err = json.Unmarshal(b, &g)
+		return g, err
+	case TypeBytes:
+		var bs Bytes
+		err = json.Unmarshal(b, &bs)
+		return bs, err
+	case TypeRelation:
+		var r Relation
+		err = json.Unmarshal(b, &r)
+		return r, err
+	}
+	return nil, errors.New("未知的字段类型: " + typ)
+}
+
+// 将 data 绑定到结构体 v 上, 按 json tag 匹配字段.
+// 特殊类型字段既可以绑定到 Date, Pointer 等类型, 日期也可以绑定到 time.Time.
+// NOTE: 普通字符串绑定到 time.Time 时只支持 RFC3339 格式, 其他格式请使用 Date
+func Bind(data map[string]interface{}, v interface{}) error {
+	b, err := json.Marshal(normalizeDates(data))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// 将日期统一转换为 RFC3339 字符串, 使其既能解码为 Date, 也能解码为 time.Time
+func normalizeDates(v interface{}) interface{} {
+	switch t := v.(type) {
+	case Date:
+		return t.UTC().Format(time.RFC3339Nano)
+	case *Date:
+		if t == nil {
+			return nil
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			list[i] = normalizeDates(item)
+		}
+		return list
+	case map[string]interface{}:
+		if t["__type"] == TypeDate {
+			if d, err := ParseDate(t); err == nil {
+				return d.UTC().Format(time.RFC3339Nano)
+			}
+		}
+		result := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			result[k] = normalizeDates(item)
+		}
+		return result
+	}
+	return v
+}
+
+// 将 Data 绑定到结构体
+func (req *CloudRequest) Bind(v interface{}) error {
+	return Bind(req.Data, v)
+}
+
+// 将 Previous 绑定到结构体
+func (req *CloudRequest) BindPrevious(v interface{}) error {
+	return Bind(req.Previous, v)
+}
+
+// 将 afterFind 的 Objects 绑定到结构体切片, v 如 *[]Order
+func (req *CloudRequest) BindObjects(v interface{}) error {
+	list := make([]interface{}, len(req.Objects))
+	for i, obj := range req.Objects {
+		list[i] = normalizeDates(obj)
+	}
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
@@ -0,0 +1,29 @@
+package types
+
+import "testing"
+
+func TestParseDateNil(t *testing.T) {
+	var d *Date
+	if _, err := ParseDate(d); err == nil {
+		t.Fatal("nil *Date 应返回错误")
+	}
+}
+
+func TestDecodeFieldValueForm(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{map[string]interface{}{"__type": "Pointer", "className": "Post", "objectId": "a"}, Pointer{ClassName: "Post", ObjectId: "a"}},
+		{NewPointer("Post", "a"), Pointer{ClassName: "Post", ObjectId: "a"}},
+		{map[string]interface{}{"__type": "File", "name": "a.png", "url": "u"}, File{Name: "a.png", URL: "u"}},
+		{&GeoPoint{Latitude: 1, Longitude: 2}, GeoPoint{Latitude: 1, Longitude: 2}},
+		{map[string]interface{}{"__type": "Relation", "className": "User"}, Relation{ClassName: "User"}},
+		{(*Pointer)(nil), nil},
+	}
+	for _, tt := range tests {
+		if got := DecodeField(tt.in); got != tt.want {
+			t.Errorf("DecodeField(%#v) = %#v, 应为 %#v", tt.in, got, tt.want)
+		}
+	}
+}
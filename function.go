@@ -0,0 +1,6 @@
+package types
+
+import "context"
+
+// 云函数及钩子的处理函数
+type CloudFunc func(ctx context.Context, req *CloudRequest) *CloudeResponse
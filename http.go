@@ -0,0 +1,47 @@
+package types
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// 以 HTTP 方式提供云代码服务, 请求体为 CloudRequest, 返回 CloudeResponse:
+//
+//	POST /functions/createOrder
+//	POST /hooks/Order/beforeSave
+//
+// 云代码的执行结果(包括失败)都以 200 返回, 只有请求本身有误时才返回 4xx.
+//
+// h 实现了 StreamHandler 时, 云函数支持流式返回: 请求头 Accept 为 application/x-ndjson
+// 或 text/event-stream 时逐条返回结果, 最后返回带有 Errors 和 Logs 的结尾, 见 ReadStream.
+func NewHTTPHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			writeHTTPResponse(w, http.StatusMethodNotAllowed, Fail(ErrCodeInvalidQuery, "只支持 POST 请求"))
+			return
+		}
+		target, err := ParseTarget(r.URL.Path)
+		if err != nil {
+			writeHTTPResponse(w, http.StatusNotFound, Fail(ErrCodeNotFound, err.Error()))
+			return
+		}
+		var req CloudRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeHTTPResponse(w, http.StatusBadRequest, Fail(ErrCodeInvalidJSON, err.Error()))
+			return
+		}
+		if format := acceptStream(r); format != "" && target.Function != "" {
+			if sh, ok := h.(StreamHandler); ok {
+				serveHTTPStream(w, r, sh, target.Function, &req, format)
+				return
+			}
+		}
+		writeHTTPResponse(w, http.StatusOK, Dispatch(r.Context(), h, target, &req))
+	})
+}
+
+func writeHTTPResponse(w http.ResponseWriter, status int, res *CloudeResponse) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
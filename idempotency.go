@@ -0,0 +1,194 @@
+package types
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 幂等调用结果的缓存存储, 可自行实现(如 Redis)
+type IdempotencyStore interface {
+
+	// 读取缓存的返回结果, 不存在或已过期时 ok 为 false
+	Get(key string) (res *CloudeResponse, ok bool)
+
+	// 保存返回结果, ttl 后过期
+	Set(key string, res *CloudeResponse, ttl time.Duration)
+}
+
+// 基于内存的幂等缓存存储
+type MemoryIdempotencyStore struct {
+
+	// 判断过期的时钟, 为 nil 时使用系统时钟
+	Clock Clock
+
+	mu    sync.Mutex
+	items map[string]idempotencyItem
+}
+
+type idempotencyItem struct {
+	res       *CloudeResponse
+	expiresAt time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{items: make(map[string]idempotencyItem)}
+}
+
+func (s *MemoryIdempotencyStore) Get(key string) (*CloudeResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	if clockOrSystem(s.Clock).Now().After(item.expiresAt) {
+		delete(s.items, key)
+		return nil, false
+	}
+	return item.res, true
+}
+
+func (s *MemoryIdempotencyStore) Set(key string, res *CloudeResponse, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := clockOrSystem(s.Clock).Now()
+	for k, item := range s.items {
+		if now.After(item.expiresAt) {
+			delete(s.items, k)
+		}
+	}
+	s.items[key] = idempotencyItem{res: res, expiresAt: now.Add(ttl)}
+}
+
+// 幂等调用控制.
+// 同一应用同一环境的同一函数, 同一用户, 相同 IdempotencyKey 的调用在 Window 内只执行一次,
+// 之后的调用直接返回首次的结果; 并发的重复调用会等待首次调用完成.
+type Idempotency struct {
+	Store  IdempotencyStore
+	Window time.Duration
+
+	mu       sync.Mutex
+	inflight map[string]*idempotentCall
+}
+
+type idempotentCall struct {
+	done chan struct{}
+	res  *CloudeResponse
+}
+
+func NewIdempotency(store IdempotencyStore, window time.Duration) *Idempotency {
+	return &Idempotency{
+		Store:    store,
+		Window:   window,
+		inflight: make(map[string]*idempotentCall),
+	}
+}
+
+// 包装云函数, name 为函数名, 用于区分不同函数的幂等键.
+// 未带 IdempotencyKey 的调用不受影响; 失败的结果不会被缓存, 客户端可以重试.
+func (i *Idempotency) Wrap(name string, fn CloudFunc) CloudFunc {
+	return func(ctx context.Context, req *CloudRequest) *CloudeResponse {
+		if req.IdempotencyKey == "" {
+			return fn(ctx, req)
+		}
+		key := req.App.AppId + "\x00" + req.App.Environment + "\x00" + name + "\x00" + req.Session.UserId + "\x00" + req.IdempotencyKey
+
+		if res, ok := i.Store.Get(key); ok {
+			return copyResponse(res)
+		}
+
+		i.mu.Lock()
+		if call, ok := i.inflight[key]; ok {
+			i.mu.Unlock()
+			select {
+			case <-call.done:
+				return copyResponse(call.res)
+			case <-ctx.Done():
+				return Fail(ErrCodeTimeout, ctx.Err().Error())
+			}
+		}
+		// 加锁后再查一次, 避免刚完成的调用被重复执行
+		if res, ok := i.Store.Get(key); ok {
+			i.mu.Unlock()
+			return copyResponse(res)
+		}
+		call := &idempotentCall{done: make(chan struct{})}
+		i.inflight[key] = call
+		i.mu.Unlock()
+
+		defer func() {
+			i.mu.Lock()
+			delete(i.inflight, key)
+			i.mu.Unlock()
+			close(call.done)
+		}()
+
+		call.res = fn(ctx, req)
+		if call.res != nil && call.res.Successed {
+			i.Store.Set(key, copyResponse(call.res), i.Window)
+		}
+		return copyResponse(call.res)
+	}
+}
+
+// 深拷贝返回结构, 避免调用方修改缓存中的结果.
+// Data, Result 及 Objects 中的 map 和切片递归拷贝, 其他值(如 *Pointer)共用
+func copyResponse(res *CloudeResponse) *CloudeResponse {
+	if res == nil {
+		return nil
+	}
+	c := *res
+	c.Data = copyMap(res.Data)
+	c.Result = copyValue(res.Result)
+	if res.Objects != nil {
+		c.Objects = make([]map[string]interface{}, len(res.Objects))
+		for i, obj := range res.Objects {
+			c.Objects[i] = copyMap(obj)
+		}
+	}
+	c.Hide = copySlice(res.Hide)
+	c.Protect = copySlice(res.Protect)
+	c.Logs = copySlice(res.Logs)
+	return &c
+}
+
+func copySlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append(make([]T, 0, len(s)), s...)
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		c[k] = copyValue(v)
+	}
+	return c
+}
+
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return copyMap(t)
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			list[i] = copyValue(item)
+		}
+		return list
+	case []map[string]interface{}:
+		list := make([]map[string]interface{}, len(t))
+		for i, item := range t {
+			list[i] = copyMap(item)
+		}
+		return list
+	}
+	return v
+}
@@ -0,0 +1,351 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// JSON-RPC 2.0 协议.
+// 方法名为调用路径(见 Target), 如 "functions/createOrder", 参数为 CloudRequest, 结果为 CloudeResponse.
+// 云代码本身的失败放在 CloudeResponse.Errors 中返回, JSON-RPC 错误只表示协议或传输层面的问题.
+const (
+	JSONRPCVersion = "2.0"
+
+	// 关闭连接, 服务端不再接收新的调用, 处理完已收到的调用后退出
+	MethodShutdown = "$/shutdown"
+
+	// 取消调用, 参数为 {"id": 调用Id}
+	MethodCancel = "$/cancelRequest"
+)
+
+// JSON-RPC 错误码
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+
+	// 服务端等待执行的调用过多, 调用未执行, 可以稍后重试
+	RPCServerBusy = -32000
+)
+
+type rpcMessage struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *RPCError        `json:"error,omitempty"`
+}
+
+// JSON-RPC 错误
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+var errRPCClosed = errors.New("连接已关闭")
+
+// 服务端: 按 JSON-RPC 请求分发调用, 由 stdio, WebSocket 等传输方式共用
+type rpcServer struct {
+	handler Handler
+	send    func(msg *rpcMessage) error
+
+	// 并发调用数限制, 达到上限时 handle 阻塞, 读取方随之停止读取, 形成背压. nil 表示不限制
+	limit chan struct{}
+
+	// 设置后(见 setQueue) handle 不再阻塞: 达到 limit 的调用在各自的协程中排队等待,
+	// 排队数超过 maxQueued 时返回 RPCServerBusy 错误
+	maxQueued int
+
+	mu       sync.Mutex
+	inflight map[string]context.CancelFunc
+	queued   int
+	wg       sync.WaitGroup
+}
+
+func newRPCServer(h Handler, send func(*rpcMessage) error) *rpcServer {
+	return &rpcServer{handler: h, send: send, inflight: make(map[string]context.CancelFunc)}
+}
+
+// 限制并发调用数, n 小于等于 0 表示不限制
+func (s *rpcServer) setLimit(n int) {
+	if n > 0 {
+		s.limit = make(chan struct{}, n)
+	}
+}
+
+// 达到并发上限的调用排队等待而不阻塞 handle, 用于需要持续读取(如回复心跳)的传输方式
+func (s *rpcServer) setQueue(n int) {
+	s.maxQueued = n
+}
+
+// 处理一条消息, 返回 true 表示收到了关闭请求
+func (s *rpcServer) handle(ctx context.Context, msg *rpcMessage) (shutdown bool) {
+	if msg.JSONRPC != JSONRPCVersion || msg.Method == "" {
+		s.reply(msg.ID, nil, &RPCError{Code: RPCInvalidRequest, Message: "无效的 JSON-RPC 请求"})
+		return false
+	}
+	switch msg.Method {
+	case MethodShutdown:
+		s.wg.Wait()
+		s.reply(msg.ID, json.RawMessage("null"), nil)
+		return true
+	case MethodCancel:
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(msg.Params, &params) == nil {
+			s.mu.Lock()
+			if cancel, ok := s.inflight[string(params.ID)]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+		}
+		return false
+	}
+
+	target, err := ParseTarget(msg.Method)
+	if err != nil {
+		s.reply(msg.ID, nil, &RPCError{Code: RPCMethodNotFound, Message: err.Error()})
+		return false
+	}
+	var req CloudRequest
+	if len(msg.Params) > 0 {
+		if err := json.Unmarshal(msg.Params, &req); err != nil {
+			s.reply(msg.ID, nil, &RPCError{Code: RPCInvalidParams, Message: err.Error()})
+			return false
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	var key string
+	if msg.ID != nil {
+		key = string(*msg.ID)
+		s.mu.Lock()
+		s.inflight[key] = cancel
+		s.mu.Unlock()
+	}
+	abort := func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		cancel()
+	}
+	queue := s.limit != nil && s.maxQueued > 0
+	if queue {
+		s.mu.Lock()
+		busy := s.queued >= s.maxQueued
+		if !busy {
+			s.queued++
+		}
+		s.mu.Unlock()
+		if busy {
+			abort()
+			s.reply(msg.ID, nil, &RPCError{Code: RPCServerBusy, Message: "服务器繁忙"})
+			return false
+		}
+	} else if s.limit != nil {
+		select {
+		case s.limit <- struct{}{}:
+		case <-ctx.Done():
+			abort()
+			return false
+		}
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer cancel()
+		if queue {
+			acquired := false
+			select {
+			case s.limit <- struct{}{}:
+				acquired = true
+			case <-ctx.Done():
+			}
+			s.mu.Lock()
+			s.queued--
+			s.mu.Unlock()
+			if !acquired {
+				// 排队期间被取消或连接已断开
+				abort()
+				return
+			}
+		}
+		if s.limit != nil {
+			defer func() { <-s.limit }()
+		}
+		res := Dispatch(ctx, s.handler, target, &req)
+		if msg.ID == nil {
+			return
+		}
+		s.mu.Lock()
+		delete(s.inflight, key)
+		s.mu.Unlock()
+		b, err := json.Marshal(res)
+		if err != nil {
+			s.reply(msg.ID, nil, &RPCError{Code: RPCInternalError, Message: err.Error()})
+			return
+		}
+		s.reply(msg.ID, b, nil)
+	}()
+	return false
+}
+
+func (s *rpcServer) reply(id *json.RawMessage, result json.RawMessage, rpcErr *RPCError) {
+	if id == nil {
+		// 通知不需要回复; 无法解析 Id 的错误按规范以 null 回复
+		if rpcErr == nil {
+			return
+		}
+		null := json.RawMessage("null")
+		id = &null
+	}
+	s.send(&rpcMessage{JSONRPC: JSONRPCVersion, ID: id, Result: result, Error: rpcErr})
+}
+
+// 等待所有进行中的调用完成
+func (s *rpcServer) wait() {
+	s.wg.Wait()
+}
+
+// 客户端: 通过请求 Id 关联并发的调用与结果, 由 stdio, WebSocket 等传输方式共用
+type rpcClient struct {
+	send func(msg *rpcMessage) error
+
+	mu      sync.Mutex
+	nextId  int64
+	pending map[int64]chan *rpcMessage
+	err     error
+	done    chan struct{}
+}
+
+func newRPCClient(send func(*rpcMessage) error) *rpcClient {
+	return &rpcClient{send: send, pending: make(map[int64]chan *rpcMessage), done: make(chan struct{})}
+}
+
+// 发送请求并等待结果
+func (c *rpcClient) call(ctx context.Context, method string, params interface{}) (json.RawMessage, error) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextId++
+	id := c.nextId
+	ch := make(chan *rpcMessage, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	raw := json.RawMessage(fmt.Sprint(id))
+	if err := c.send(&rpcMessage{JSONRPC: JSONRPCVersion, ID: &raw, Method: method, Params: b}); err != nil {
+		c.remove(id)
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-c.done:
+		return nil, c.closeErr()
+	case <-ctx.Done():
+		c.remove(id)
+		c.notify(MethodCancel, map[string]interface{}{"id": id})
+		return nil, CloudError{Code: ErrCodeTimeout, Message: ctx.Err().Error()}
+	}
+}
+
+// 发送通知, 不等待结果
+func (c *rpcClient) notify(method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return c.send(&rpcMessage{JSONRPC: JSONRPCVersion, Method: method, Params: b})
+}
+
+// 收到服务端的回复
+func (c *rpcClient) deliver(msg *rpcMessage) {
+	if msg.ID == nil {
+		return
+	}
+	var id int64
+	if json.Unmarshal(*msg.ID, &id) != nil {
+		return
+	}
+	c.mu.Lock()
+	ch, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+}
+
+func (c *rpcClient) remove(id int64) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// 连接断开, 所有等待中的调用返回 err
+func (c *rpcClient) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if err == nil {
+		err = errRPCClosed
+	}
+	c.err = err
+	c.pending = make(map[int64]chan *rpcMessage)
+	close(c.done)
+}
+
+func (c *rpcClient) closeErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// 调用目标, 返回的错误为传输层错误; 云代码的失败在 CloudeResponse 中
+func (c *rpcClient) invoke(ctx context.Context, t Target, req *CloudRequest) (*CloudeResponse, error) {
+	result, err := c.call(ctx, t.Path(), req)
+	if err != nil {
+		return nil, err
+	}
+	var res CloudeResponse
+	if err := json.Unmarshal(result, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// 将传输层错误转换为失败的返回结构, 用于实现 Handler
+func responseOrFail(res *CloudeResponse, err error) *CloudeResponse {
+	if err == nil {
+		return res
+	}
+	if cerr, ok := err.(CloudError); ok {
+		return Fail(cerr.Code, cerr.Message)
+	}
+	return Fail(ErrCodeInternal, err.Error())
+}
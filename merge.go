@@ -0,0 +1,211 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// 多个处理函数修改同一字段时的处理方式
+type ConflictPolicy int
+
+const (
+	ConflictError     ConflictPolicy = iota // 值不同时返回错误
+	ConflictLastWins                        // 以后注册的处理函数为准
+	ConflictFirstWins                       // 以先注册的处理函数为准
+)
+
+// 合并同一表同一钩子上多个处理函数的返回结果, responses 按注册顺序传入, nil 会被忽略.
+//
+//	Data       按字段合并, 多个处理函数写入不同值时按 policy 处理;
+//	           同一字段上同类的原子操作会合并(Increment 相加, Add/AddUnique/Remove 连接 objects), 不同类的操作按 policy 处理
+//	Result, ExtraData  同 Data
+//	Hide, Protect  取并集, 保持首次出现的顺序
+//	Logs       按顺序连接
+//	失败        遇到第一个失败的结果即停止合并, 返回该错误及之前所有的 Logs
+func MergeResponses(policy ConflictPolicy, responses ...*CloudeResponse) (*CloudeResponse, error) {
+	merged := &CloudeResponse{Successed: true}
+	var conflicts []string
+	resultSet, extraSet := false, false
+
+	for _, res := range responses {
+		if res == nil {
+			continue
+		}
+		merged.Logs = append(merged.Logs, res.Logs...)
+		if !res.Successed {
+			return &CloudeResponse{Errors: res.Errors, Logs: merged.Logs}, nil
+		}
+
+		for field, v := range res.Data {
+			if merged.Data == nil {
+				merged.Data = make(map[string]interface{})
+			}
+			prev, exists := merged.Data[field]
+			if exists {
+				if op, ok := combineOperations(prev, v); ok {
+					merged.Data[field] = op
+					continue
+				}
+			}
+			if !exists || sameValue(prev, v) {
+				merged.Data[field] = v
+				continue
+			}
+			switch policy {
+			case ConflictLastWins:
+				merged.Data[field] = v
+			case ConflictFirstWins:
+			default:
+				conflicts = append(conflicts, "data."+field)
+			}
+		}
+
+		if res.Result != nil {
+			if resultSet && !sameValue(merged.Result, res.Result) {
+				switch policy {
+				case ConflictLastWins:
+					merged.Result = res.Result
+				case ConflictFirstWins:
+				default:
+					conflicts = append(conflicts, "result")
+				}
+			} else {
+				merged.Result = res.Result
+				resultSet = true
+			}
+		}
+
+		if res.ExtraData != "" {
+			if extraSet && merged.ExtraData != res.ExtraData {
+				switch policy {
+				case ConflictLastWins:
+					merged.ExtraData = res.ExtraData
+				case ConflictFirstWins:
+				default:
+					conflicts = append(conflicts, "extraData")
+				}
+			} else {
+				merged.ExtraData = res.ExtraData
+				extraSet = true
+			}
+		}
+
+		merged.Hide = unionStrings(merged.Hide, res.Hide)
+		merged.Protect = unionStrings(merged.Protect, res.Protect)
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return nil, CloudError{
+			Code:    ErrCodeCloudFailure,
+			Message: fmt.Sprintf("多个处理函数修改了相同的字段: %s", strings.Join(dedupe(conflicts), ", ")),
+		}
+	}
+	return merged, nil
+}
+
+// 判断两个值是否相同, 原子操作及特殊类型按编码后的值比较
+func sameValue(a, b interface{}) bool {
+	if valuesEqual(a, b) {
+		return true
+	}
+	return reflect.DeepEqual(toJSONValue(a), toJSONValue(b))
+}
+
+// 合并同一字段上同类的两个原子操作, 不是同类的原子操作时 ok 为 false
+func combineOperations(a, b interface{}) (op Operation, ok bool) {
+	x, err := ParseOperation(a)
+	if err != nil || x == nil {
+		return nil, false
+	}
+	y, err := ParseOperation(b)
+	if err != nil || y == nil || x.Op() != y.Op() {
+		return nil, false
+	}
+	switch x.Op() {
+	case OpIncrement:
+		return NewIncrement(incrementAmount(x) + incrementAmount(y)), true
+	case OpAdd:
+		return NewAdd(concatObjects(x, y)...), true
+	case OpAddUnique:
+		return NewAddUnique(concatObjects(x, y)...), true
+	case OpRemove:
+		return NewRemove(concatObjects(x, y)...), true
+	case OpDelete:
+		return NewDelete(), true
+	}
+	return nil, false
+}
+
+func incrementAmount(op Operation) float64 {
+	switch t := op.(type) {
+	case Increment:
+		return t.Amount
+	case *Increment:
+		return t.Amount
+	}
+	return 0
+}
+
+func concatObjects(x, y Operation) []interface{} {
+	var list []interface{}
+	for _, op := range []Operation{x, y} {
+		switch t := op.(type) {
+		case Add:
+			list = append(list, t.Objects...)
+		case *Add:
+			list = append(list, t.Objects...)
+		case AddUnique:
+			list = append(list, t.Objects...)
+		case *AddUnique:
+			list = append(list, t.Objects...)
+		case Remove:
+			list = append(list, t.Objects...)
+		case *Remove:
+			list = append(list, t.Objects...)
+		}
+	}
+	return list
+}
+
+func unionStrings(list, items []string) []string {
+	for _, item := range items {
+		found := false
+		for _, s := range list {
+			if s == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func dedupe(sorted []string) []string {
+	var result []string
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// 转换为 JSON 编码后再解码的值, 便于比较不同 Go 类型表示的同一个值
+func toJSONValue(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var result interface{}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return v
+	}
+	return result
+}
@@ -0,0 +1,414 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 云函数的说明, 用于生成 OpenAPI 文档
+//
+//	registry.Define("createOrder", createOrder)
+//	registry.Describe("createOrder", types.FunctionSpec{
+//		Summary: "创建订单",
+//		Params:  CreateOrderParams{},
+//		Result:  Order{},
+//		Errors:  []int{types.ErrCodeNotFound, types.ErrCodeForbidden},
+//	})
+type FunctionSpec struct {
+	Summary     string
+	Description string
+
+	// CloudRequest.Data 的结构, 为结构体(或其指针)的零值.
+	// 字段名取 json 标签, 带 omitempty 的字段为可选, description 标签为字段说明
+	Params interface{}
+
+	// CloudeResponse.Result 的结构; 流式云函数为每条结果的结构
+	Result interface{}
+
+	// 可能返回的错误码, ErrCodeCloudFailure 总是包含在内
+	Errors []int
+}
+
+// OpenAPI 3 文档, 只包含描述云函数所需的部分
+type OpenAPIDocument struct {
+	OpenAPI    string                  `json:"openapi"`
+	Info       OpenAPIInfo             `json:"info"`
+	Paths      map[string]*OpenAPIPath `json:"paths"`
+	Components OpenAPIComponents       `json:"components"`
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPIPath struct {
+	Post *OpenAPIOperation `json:"post,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationId string                      `json:"operationId"`
+	Summary     string                      `json:"summary,omitempty"`
+	Description string                      `json:"description,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]OpenAPIMedia `json:"content"`
+}
+
+type OpenAPIResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]OpenAPIMedia `json:"content,omitempty"`
+}
+
+type OpenAPIMedia struct {
+	Schema *Schema `json:"schema"`
+}
+
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// JSON Schema (OpenAPI 3.0 子集)
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
+
+// 为云函数添加说明, 可以在 Define 之前或之后调用; 生成文档及客户端时云函数必须已定义
+func (r *Registry) Describe(name string, spec FunctionSpec) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.specs[name] = spec
+}
+
+// 读取云函数的说明
+func (r *Registry) Spec(name string) (FunctionSpec, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	spec, ok := r.specs[name]
+	return spec, ok
+}
+
+// 检查 Describe 过的云函数都已定义, 以免函数名写错时说明被静默忽略
+func (r *Registry) checkSpecs() error {
+	r.mu.RLock()
+	var missing []string
+	for name := range r.specs {
+		if r.functions[name] == nil && r.streams[name] == nil {
+			missing = append(missing, name)
+		}
+	}
+	r.mu.RUnlock()
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	return fmt.Errorf("云函数未定义, 但有说明: %s", strings.Join(missing, ", "))
+}
+
+// 生成所有云函数的 OpenAPI 文档, 路径为 /functions/{name}.
+// 请求体只描述前台传入的 data, 返回值为 CloudeResponse, 其中 result 为 FunctionSpec.Result 的结构.
+// 有说明(见 Describe)但未定义的云函数时返回错误
+func (r *Registry) OpenAPI(info OpenAPIInfo) (*OpenAPIDocument, error) {
+	if err := r.checkSpecs(); err != nil {
+		return nil, err
+	}
+	doc := &OpenAPIDocument{
+		OpenAPI:    "3.0.3",
+		Info:       info,
+		Paths:      make(map[string]*OpenAPIPath),
+		Components: OpenAPIComponents{Schemas: make(map[string]*Schema)},
+	}
+	b := &schemaBuilder{schemas: doc.Components.Schemas, names: make(map[reflect.Type]string)}
+	logSchema := b.schemaOf(reflect.TypeOf(CloudLog{}))
+	trailerSchema := b.schemaOf(reflect.TypeOf(StreamTrailer{}))
+
+	for _, name := range r.FunctionNames() {
+		spec, _ := r.Spec(name)
+		_, stream := r.StreamFunction(name)
+
+		params := &Schema{Type: "object"}
+		if spec.Params != nil {
+			params = b.schemaOf(reflect.TypeOf(spec.Params))
+		}
+		result := &Schema{}
+		if spec.Result != nil {
+			result = b.schemaOf(reflect.TypeOf(spec.Result))
+		}
+		errSchema := errorSchema(spec.Errors)
+
+		content := map[string]OpenAPIMedia{}
+		if stream {
+			content["application/json"] = OpenAPIMedia{Schema: responseSchema(&Schema{Type: "array", Items: result}, errSchema, logSchema)}
+			line := &Schema{Type: "object", Properties: map[string]*Schema{"item": result, "trailer": trailerSchema}}
+			content[string(StreamNDJSON)] = OpenAPIMedia{Schema: line}
+			content[string(StreamSSE)] = OpenAPIMedia{Schema: &Schema{Type: "string"}}
+		} else {
+			content["application/json"] = OpenAPIMedia{Schema: responseSchema(result, errSchema, logSchema)}
+		}
+
+		description := spec.Description
+		if stream {
+			description = strings.TrimSpace(description + "\n\n流式云函数: 请求头 Accept 为 application/x-ndjson 或 text/event-stream 时逐条返回结果.")
+		}
+		doc.Paths["/functions/"+name] = &OpenAPIPath{Post: &OpenAPIOperation{
+			OperationId: name,
+			Summary:     spec.Summary,
+			Description: description,
+			RequestBody: &OpenAPIRequestBody{
+				Required: true,
+				Content: map[string]OpenAPIMedia{"application/json": {Schema: &Schema{
+					Type:       "object",
+					Properties: map[string]*Schema{"data": params},
+				}}},
+			},
+			Responses: map[string]*OpenAPIResponse{
+				"200": {Description: "调用结果, 失败时 successed 为 false, 错误在 error 中", Content: content},
+			},
+		}}
+	}
+	return doc, nil
+}
+
+// 以 JSON 返回 OpenAPI 文档, 每次请求时重新生成
+func NewOpenAPIHandler(r *Registry, info OpenAPIInfo) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "GET" && req.Method != "HEAD" {
+			writeHTTPResponse(w, http.StatusMethodNotAllowed, Fail(ErrCodeInvalidQuery, "只支持 GET 请求"))
+			return
+		}
+		doc, err := r.OpenAPI(info)
+		if err != nil {
+			writeHTTPResponse(w, http.StatusInternalServerError, Fail(ErrCodeInternal, err.Error()))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(doc)
+	})
+}
+
+func responseSchema(result, errSchema, logSchema *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"successed": {Type: "boolean"},
+			"result":    result,
+			"error":     errSchema,
+			"logs":      {Type: "array", Items: logSchema},
+		},
+		Required: []string{"successed"},
+	}
+}
+
+func errorSchema(codes []int) *Schema {
+	seen := map[int]bool{ErrCodeCloudFailure: true}
+	all := []int{ErrCodeCloudFailure}
+	for _, code := range codes {
+		if !seen[code] {
+			seen[code] = true
+			all = append(all, code)
+		}
+	}
+	sort.Ints(all)
+
+	enum := make([]interface{}, 0, len(all)+1)
+	enum = append(enum, 0)
+	lines := []string{"0: 成功"}
+	for _, code := range all {
+		enum = append(enum, code)
+		lines = append(lines, fmt.Sprintf("%d: %s", code, errCodeText[code]))
+	}
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":    {Type: "integer", Enum: enum, Description: strings.Join(lines, "\n")},
+			"message": {Type: "string"},
+		},
+	}
+}
+
+// 由 Go 类型生成 Schema, 有名称的结构体放入 components 并以 $ref 引用
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if s := fieldTypeSchema(t); s != nil {
+		return s
+	}
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name, ok := b.names[t]
+		if !ok {
+			name = b.componentName(t)
+			b.names[t] = name
+			// 先占位, 避免递归类型无限展开
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	// interface{} 等任意值
+	return &Schema{}
+}
+
+// 不同包中的同名类型以包名区分
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := b.schemas[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	return pkg + "." + name
+}
+
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	b.addFields(s, t)
+	return s
+}
+
+func (b *schemaBuilder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		// 未指定名称的嵌入结构体, 字段提升到外层
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && fieldTypeSchema(ft) == nil {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var fs *Schema
+		if hasTagOption(opts, "string") {
+			fs = &Schema{Type: "string"}
+		} else {
+			fs = b.schemaOf(f.Type)
+		}
+		if desc := f.Tag.Get("description"); desc != "" {
+			if fs.Ref != "" {
+				// $ref 不能带其他属性
+				fs = &Schema{Ref: fs.Ref}
+			} else {
+				copied := *fs
+				fs = &copied
+				fs.Description = desc
+			}
+		}
+		s.Properties[name] = fs
+		if !hasTagOption(opts, "omitempty") && f.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+func hasTagOption(opts, option string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// 带 __type 的字段类型(见 field.go)
+func fieldTypeSchema(t reflect.Type) *Schema {
+	typed := func(typ string, props map[string]*Schema) *Schema {
+		props["__type"] = &Schema{Type: "string", Enum: []interface{}{typ}}
+		required := make([]string, 0, len(props))
+		for name := range props {
+			required = append(required, name)
+		}
+		sort.Strings(required)
+		return &Schema{Type: "object", Properties: props, Required: required}
+	}
+	switch t {
+	case reflect.TypeOf(Date{}):
+		return typed(TypeDate, map[string]*Schema{"iso": {Type: "string", Format: "date-time"}})
+	case reflect.TypeOf(Pointer{}):
+		return typed(TypePointer, map[string]*Schema{"className": {Type: "string"}, "objectId": {Type: "string"}})
+	case reflect.TypeOf(File{}):
+		return typed(TypeFile, map[string]*Schema{"name": {Type: "string"}, "url": {Type: "string"}})
+	case reflect.TypeOf(GeoPoint{}):
+		return typed(TypeGeoPoint, map[string]*Schema{"latitude": {Type: "number"}, "longitude": {Type: "number"}})
+	case reflect.TypeOf(Bytes{}):
+		return typed(TypeBytes, map[string]*Schema{"base64": {Type: "string", Format: "byte"}})
+	case reflect.TypeOf(Relation{}):
+		return typed(TypeRelation, map[string]*Schema{"className": {Type: "string"}})
+	}
+	return nil
+}
@@ -0,0 +1,287 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// 原子操作名称, 编码为 {"__op": "Increment", ...}
+const (
+	OpIncrement = "Increment" // 数值增加 amount, amount 可为负数
+	OpAdd       = "Add"       // 向数组末尾添加元素
+	OpAddUnique = "AddUnique" // 向数组添加不存在的元素
+	OpRemove    = "Remove"    // 从数组中移除元素
+	OpDelete    = "Delete"    // 删除字段
+)
+
+// 字段的原子操作.
+// 可以直接放入 CloudeResponse.Data, 由 API 服务器原子执行, 避免并发更新时相互覆盖.
+// Increment 等类型的值及指针都实现了此接口, 如 types.Increment{Amount: 1} 与 types.NewIncrement(1) 相同
+type Operation interface {
+
+	// 操作名称, 如 OpIncrement
+	Op() string
+
+	// 根据旧值计算新值. exists 表示旧值是否存在;
+	// 返回的 deleted 为 true 时表示字段应被删除
+	Apply(prev interface{}, exists bool) (value interface{}, deleted bool, err error)
+}
+
+// 数值增加
+type Increment struct {
+	Amount float64
+}
+
+// 数组添加
+type Add struct {
+	Objects []interface{}
+}
+
+// 数组添加(去重)
+type AddUnique struct {
+	Objects []interface{}
+}
+
+// 数组移除
+type Remove struct {
+	Objects []interface{}
+}
+
+// 删除字段
+type Delete struct{}
+
+func NewIncrement(amount float64) *Increment         { return &Increment{Amount: amount} }
+func NewAdd(objects ...interface{}) *Add             { return &Add{Objects: objects} }
+func NewAddUnique(objects ...interface{}) *AddUnique { return &AddUnique{Objects: objects} }
+func NewRemove(objects ...interface{}) *Remove       { return &Remove{Objects: objects} }
+func NewDelete() *Delete                             { return &Delete{} }
+
+func (op Increment) Op() string { return OpIncrement }
+func (op Add) Op() string       { return OpAdd }
+func (op AddUnique) Op() string { return OpAddUnique }
+func (op Remove) Op() string    { return OpRemove }
+func (op Delete) Op() string    { return OpDelete }
+
+func (op Increment) Apply(prev interface{}, exists bool) (interface{}, bool, error) {
+	if !exists || prev == nil {
+		return op.Amount, false, nil
+	}
+	n, ok := toFloat(prev)
+	if !ok {
+		return nil, false, fmt.Errorf("Increment 只能用于数值字段, 旧值为 %T", prev)
+	}
+	return n + op.Amount, false, nil
+}
+
+func (op Add) Apply(prev interface{}, exists bool) (interface{}, bool, error) {
+	list, err := toList(OpAdd, prev, exists)
+	if err != nil {
+		return nil, false, err
+	}
+	return append(list, op.Objects...), false, nil
+}
+
+func (op AddUnique) Apply(prev interface{}, exists bool) (interface{}, bool, error) {
+	list, err := toList(OpAddUnique, prev, exists)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, obj := range op.Objects {
+		if indexOf(list, obj) < 0 {
+			list = append(list, obj)
+		}
+	}
+	return list, false, nil
+}
+
+func (op Remove) Apply(prev interface{}, exists bool) (interface{}, bool, error) {
+	list, err := toList(OpRemove, prev, exists)
+	if err != nil {
+		return nil, false, err
+	}
+	result := make([]interface{}, 0, len(list))
+	for _, item := range list {
+		if indexOf(op.Objects, item) < 0 {
+			result = append(result, item)
+		}
+	}
+	return result, false, nil
+}
+
+func (op Delete) Apply(prev interface{}, exists bool) (interface{}, bool, error) {
+	return nil, true, nil
+}
+
+func (op Increment) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"__op": OpIncrement, "amount": op.Amount})
+}
+
+func (op Add) MarshalJSON() ([]byte, error) {
+	return marshalObjectsOp(OpAdd, op.Objects)
+}
+
+func (op AddUnique) MarshalJSON() ([]byte, error) {
+	return marshalObjectsOp(OpAddUnique, op.Objects)
+}
+
+func (op Remove) MarshalJSON() ([]byte, error) {
+	return marshalObjectsOp(OpRemove, op.Objects)
+}
+
+func (op Delete) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"__op": OpDelete})
+}
+
+func marshalObjectsOp(name string, objects []interface{}) ([]byte, error) {
+	if objects == nil {
+		objects = []interface{}{}
+	}
+	return json.Marshal(map[string]interface{}{"__op": name, "objects": objects})
+}
+
+// 判断值是否为原子操作, 包括 Operation 类型及解码后带 "__op" 的 map
+func IsOperation(v interface{}) bool {
+	switch t := v.(type) {
+	case Operation:
+		return true
+	case map[string]interface{}:
+		_, ok := t["__op"].(string)
+		return ok
+	}
+	return false
+}
+
+// 将 CloudRequest.Data 中的字段值解析为原子操作.
+// 值不是原子操作时 op 为 nil, err 为 nil
+func ParseOperation(v interface{}) (op Operation, err error) {
+	switch t := v.(type) {
+	case Operation:
+		return t, nil
+	case map[string]interface{}:
+		name, ok := t["__op"].(string)
+		if !ok {
+			return nil, nil
+		}
+		switch name {
+		case OpIncrement:
+			amount, ok := toFloat(t["amount"])
+			if !ok {
+				return nil, fmt.Errorf("Increment 操作的 amount 必须是数值: %v", t["amount"])
+			}
+			return &Increment{Amount: amount}, nil
+		case OpAdd, OpAddUnique, OpRemove:
+			objects, ok := t["objects"].([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s 操作的 objects 必须是数组: %v", name, t["objects"])
+			}
+			switch name {
+			case OpAdd:
+				return &Add{Objects: objects}, nil
+			case OpAddUnique:
+				return &AddUnique{Objects: objects}, nil
+			default:
+				return &Remove{Objects: objects}, nil
+			}
+		case OpDelete:
+			return &Delete{}, nil
+		default:
+			return nil, fmt.Errorf("不支持的操作: %q", name)
+		}
+	}
+	return nil, nil
+}
+
+// 取出 Data 中所有的原子操作
+func Operations(data map[string]interface{}) (map[string]Operation, error) {
+	ops := make(map[string]Operation)
+	for field, v := range data {
+		op, err := ParseOperation(v)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %v", field, err)
+		}
+		if op != nil {
+			ops[field] = op
+		}
+	}
+	return ops, nil
+}
+
+// 根据 previous 计算 data 应用后的对象, 普通值直接覆盖, 原子操作按旧值计算.
+// 不会修改 previous
+func ApplyData(previous, data map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(previous)+len(data))
+	for k, v := range previous {
+		result[k] = v
+	}
+	for field, v := range data {
+		op, err := ParseOperation(v)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %v", field, err)
+		}
+		if op == nil {
+			result[field] = v
+			continue
+		}
+		prev, exists := result[field]
+		value, deleted, err := op.Apply(prev, exists)
+		if err != nil {
+			return nil, fmt.Errorf("字段 %s: %v", field, err)
+		}
+		if deleted {
+			delete(result, field)
+		} else {
+			result[field] = value
+		}
+	}
+	return result, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toList(name string, prev interface{}, exists bool) ([]interface{}, error) {
+	if !exists || prev == nil {
+		return []interface{}{}, nil
+	}
+	list, ok := prev.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s 只能用于数组字段, 旧值为 %T", name, prev)
+	}
+	return append([]interface{}{}, list...), nil
+}
+
+func indexOf(list []interface{}, v interface{}) int {
+	for i, item := range list {
+		if valuesEqual(item, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+// 比较两个字段值, 数值类型不同但值相同时视为相等(如 int 1 与解码后的 float64 1)
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x == y
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
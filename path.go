@@ -0,0 +1,219 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Hide 及 Protect 中的字段路径规则, API 服务器与云代码使用同一规则:
+//
+//	"phone"           顶层字段
+//	"profile.idCard"  嵌套对象中的字段, 以 "." 分隔
+//	"*.secret"        "*" 匹配一层任意字段名, 如 "profile.secret"
+//	"**.secret"       "**" 匹配任意多层(包括零层), 如 "secret", "a.b.secret"
+//	"token*"          单层内可以使用 path.Match 的通配符, 如 "token", "tokenExpire"
+//
+// 路径经过数组时数组本身不占层级, 如 "items.price" 匹配 items 数组中每个对象的 price 字段.
+// 匹配某个路径的规则同时作用于其下所有子字段.
+func MatchPath(pattern, fieldPath string) bool {
+	return matchSegments(splitPath(pattern), splitPath(fieldPath))
+}
+
+// 判断路径是否匹配 patterns 中任意一条规则, 或位于匹配路径之下
+func MatchAnyPath(patterns []string, fieldPath string) bool {
+	segments := splitPath(fieldPath)
+	for _, pattern := range patterns {
+		p := splitPath(pattern)
+		for i := 1; i <= len(segments); i++ {
+			if matchSegments(p, segments[:i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func splitPath(p string) []string {
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, ".")
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
+
+// 返回隐藏了 patterns 所匹配字段后的对象副本, 不会修改 obj
+func HideFields(obj map[string]interface{}, patterns []string) map[string]interface{} {
+	if obj == nil || len(patterns) == 0 {
+		return obj
+	}
+	return hideObject(obj, "", patterns, false)
+}
+
+// 返回将 patterns 所匹配字段的值替换为 Redacted 后的对象副本, 不会修改 obj.
+// 与 HideFields 不同, 字段本身会保留, 用于记录哪些字段有值但不记录其内容
+func RedactFields(obj map[string]interface{}, patterns []string) map[string]interface{} {
+	if obj == nil || len(patterns) == 0 {
+		return obj
+	}
+	return hideObject(obj, "", patterns, true)
+}
+
+// 被遮盖字段的值
+const Redacted = "[REDACTED]"
+
+func hideObject(obj map[string]interface{}, prefix string, patterns []string, redact bool) map[string]interface{} {
+	result := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		p := joinPath(prefix, k)
+		if MatchAnyPath(patterns, p) {
+			if redact {
+				result[k] = Redacted
+			}
+			continue
+		}
+		result[k] = hideValue(v, p, patterns, redact)
+	}
+	return result
+}
+
+func hideValue(v interface{}, p string, patterns []string, redact bool) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if _, typed := t["__type"]; typed {
+			return t
+		}
+		return hideObject(t, p, patterns, redact)
+	case []interface{}:
+		list := make([]interface{}, len(t))
+		for i, item := range t {
+			list[i] = hideValue(item, p, patterns, redact)
+		}
+		return list
+	}
+	return v
+}
+
+// 检查 data 是否修改了 patterns 所保护的字段, 是则返回 ErrCodeForbidden 错误.
+// data 的键可以是 "profile.idCard" 形式的路径; 写入嵌套对象时会检查对象内的每个字段.
+// 整体写入(替换, 删除, 原子操作或 null)受保护字段的上层字段, 如 Protect 为 "profile.idCard" 时写入 "profile",
+// 同样视为修改, 只修改其他字段时应使用 "profile.name" 形式的键.
+// NOTE: 以通配符开头的规则(如 "**.secret")可能匹配任意字段之下的路径, 只检查直接写入匹配字段的情况
+func CheckProtected(data map[string]interface{}, patterns []string) error {
+	if len(patterns) == 0 {
+		return nil
+	}
+	if p := findProtected(data, "", patterns); p != "" {
+		return CloudError{Code: ErrCodeForbidden, Message: fmt.Sprintf("字段 %s 受保护, 不能修改", p)}
+	}
+	return nil
+}
+
+func findProtected(v interface{}, p string, patterns []string) string {
+	if p != "" && (MatchAnyPath(patterns, p) || protectsBelow(patterns, p)) {
+		return p
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if IsOperation(t) {
+			return ""
+		}
+		if _, typed := t["__type"]; typed {
+			return ""
+		}
+		for k, item := range t {
+			if found := findProtected(item, joinPath(p, k), patterns); found != "" {
+				return found
+			}
+		}
+	case []interface{}:
+		for _, item := range t {
+			if found := findProtected(item, p, patterns); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+// 判断 patterns 中以具体字段名开头的规则是否可能匹配 fieldPath 之下的路径
+func protectsBelow(patterns []string, fieldPath string) bool {
+	segments := splitPath(fieldPath)
+	for _, pattern := range patterns {
+		p := splitPath(pattern)
+		if len(p) > 0 && isLiteralSegment(p[0]) && matchBelow(p, segments) {
+			return true
+		}
+	}
+	return false
+}
+
+func isLiteralSegment(s string) bool {
+	return !strings.ContainsAny(s, `*?[\`)
+}
+
+// 判断 pattern 是否可能匹配以 segments 开头且更长的路径
+func matchBelow(pattern, segments []string) bool {
+	for len(segments) > 0 {
+		if len(pattern) == 0 {
+			return false
+		}
+		if pattern[0] == "**" {
+			return true
+		}
+		if ok, err := path.Match(pattern[0], segments[0]); err != nil || !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(pattern) > 0
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// 按 Hide 隐藏返回给客户端的对象中的字段
+func (res *CloudeResponse) ApplyHide(obj map[string]interface{}) map[string]interface{} {
+	return HideFields(obj, res.Hide)
+}
+
+// 按 Hide 隐藏对象列表中每个对象的字段, 返回新的列表
+func (res *CloudeResponse) ApplyHideList(objects []map[string]interface{}) []map[string]interface{} {
+	if objects == nil || len(res.Hide) == 0 {
+		return objects
+	}
+	list := make([]map[string]interface{}, len(objects))
+	for i, obj := range objects {
+		list[i] = HideFields(obj, res.Hide)
+	}
+	return list
+}
+
+// 按 Protect 检查客户端传入的 Data
+func (res *CloudeResponse) CheckProtect(data map[string]interface{}) error {
+	return CheckProtected(data, res.Protect)
+}
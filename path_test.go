@@ -0,0 +1,31 @@
+package types
+
+import "testing"
+
+func TestCheckProtectedParent(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		data     map[string]interface{}
+		ok       bool
+	}{
+		{"删除上层字段", []string{"profile.idCard"}, map[string]interface{}{"profile": map[string]interface{}{"__op": "Delete"}}, false},
+		{"删除操作类型", []string{"profile.idCard"}, map[string]interface{}{"profile": NewDelete()}, false},
+		{"替换上层对象", []string{"profile.idCard"}, map[string]interface{}{"profile": map[string]interface{}{"name": "x"}}, false},
+		{"上层字段为 null", []string{"profile.idCard"}, map[string]interface{}{"profile": nil}, false},
+		{"上层字段为普通值", []string{"profile.idCard"}, map[string]interface{}{"profile": "x"}, false},
+		{"写入受保护字段", []string{"profile.idCard"}, map[string]interface{}{"profile.idCard": "1"}, false},
+		{"嵌套写入受保护字段", []string{"profile.idCard"}, map[string]interface{}{"profile": map[string]interface{}{"idCard": "1"}}, false},
+		{"** 规则的上层字段", []string{"profile.**.idCard"}, map[string]interface{}{"profile": map[string]interface{}{"name": "x"}}, false},
+		{"** 规则的中间层字段", []string{"profile.**.idCard"}, map[string]interface{}{"profile.address": nil}, false},
+		{"路径形式修改其他字段", []string{"profile.idCard"}, map[string]interface{}{"profile.name": "x"}, true},
+		{"其他顶层字段", []string{"profile.idCard"}, map[string]interface{}{"name": "x"}, true},
+		{"通配符开头的规则", []string{"**.secret"}, map[string]interface{}{"name": "x"}, true},
+	}
+	for _, tt := range tests {
+		err := CheckProtected(tt.data, tt.patterns)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: CheckProtected(%v, %v) = %v", tt.name, tt.data, tt.patterns, err)
+		}
+	}
+}
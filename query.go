@@ -0,0 +1,331 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// 查询条件操作符
+const (
+	QueryOpNotEqual       = "$ne"
+	QueryOpLessThan       = "$lt"
+	QueryOpLessOrEqual    = "$lte"
+	QueryOpGreaterThan    = "$gt"
+	QueryOpGreaterOrEqual = "$gte"
+	QueryOpIn             = "$in"
+	QueryOpNotIn          = "$nin"
+	QueryOpExists         = "$exists"
+	QueryOpRegex          = "$regex"
+	QueryOpRegexOptions   = "$options"
+	QueryOpNear           = "$nearSphere"
+	QueryOpMaxDistance    = "$maxDistanceInKilometers"
+)
+
+// 云代码回调数据 API 时的查询描述.
+// 编码后与数据 API 的查询参数格式一致, 如:
+//
+//	{"className":"Post","where":{"score":{"$gt":10}},"order":"-createdAt","limit":20}
+type Query struct {
+
+	// 查询的表名
+	ClassName string
+
+	// 查询条件
+	Where map[string]interface{}
+
+	// 排序字段, 降序时以 "-" 开头
+	Order []string
+
+	// 返回条数, 0 表示使用服务器默认值
+	Limit int
+
+	// 跳过条数
+	Skip int
+
+	// 只返回指定字段
+	Keys []string
+
+	// 同时返回 Pointer 字段指向的对象
+	Include []string
+}
+
+func NewQuery(className string) *Query {
+	return &Query{ClassName: className, Where: make(map[string]interface{})}
+}
+
+// 字段等于 value
+func (q *Query) EqualTo(key string, value interface{}) *Query {
+	q.where()[key] = value
+	return q
+}
+
+// 字段不等于 value
+func (q *Query) NotEqualTo(key string, value interface{}) *Query {
+	return q.addCondition(key, QueryOpNotEqual, value)
+}
+
+// 字段小于 value
+func (q *Query) LessThan(key string, value interface{}) *Query {
+	return q.addCondition(key, QueryOpLessThan, value)
+}
+
+// 字段小于等于 value
+func (q *Query) LessThanOrEqualTo(key string, value interface{}) *Query {
+	return q.addCondition(key, QueryOpLessOrEqual, value)
+}
+
+// 字段大于 value
+func (q *Query) GreaterThan(key string, value interface{}) *Query {
+	return q.addCondition(key, QueryOpGreaterThan, value)
+}
+
+// 字段大于等于 value
+func (q *Query) GreaterThanOrEqualTo(key string, value interface{}) *Query {
+	return q.addCondition(key, QueryOpGreaterOrEqual, value)
+}
+
+// 字段值在 values 中
+func (q *Query) ContainedIn(key string, values ...interface{}) *Query {
+	return q.addCondition(key, QueryOpIn, values)
+}
+
+// 字段值不在 values 中
+func (q *Query) NotContainedIn(key string, values ...interface{}) *Query {
+	return q.addCondition(key, QueryOpNotIn, values)
+}
+
+// 字段存在
+func (q *Query) Exists(key string) *Query {
+	return q.addCondition(key, QueryOpExists, true)
+}
+
+// 字段不存在
+func (q *Query) DoesNotExist(key string) *Query {
+	return q.addCondition(key, QueryOpExists, false)
+}
+
+// 字段匹配正则表达式, options 如 "i" 表示忽略大小写, 可以为 ""
+func (q *Query) Matches(key, regex, options string) *Query {
+	q.addCondition(key, QueryOpRegex, regex)
+	if options != "" {
+		q.addCondition(key, QueryOpRegexOptions, options)
+	}
+	return q
+}
+
+// 按距离 point 由近到远返回, maxKilometers 大于 0 时只返回该距离以内的对象
+func (q *Query) Near(key string, point GeoPoint, maxKilometers float64) *Query {
+	q.addCondition(key, QueryOpNear, point)
+	if maxKilometers > 0 {
+		q.addCondition(key, QueryOpMaxDistance, maxKilometers)
+	}
+	return q
+}
+
+// 按字段升序
+func (q *Query) Ascending(keys ...string) *Query {
+	q.Order = append(q.Order, keys...)
+	return q
+}
+
+// 按字段降序
+func (q *Query) Descending(keys ...string) *Query {
+	for _, key := range keys {
+		q.Order = append(q.Order, "-"+key)
+	}
+	return q
+}
+
+func (q *Query) SetLimit(limit int) *Query {
+	q.Limit = limit
+	return q
+}
+
+func (q *Query) SetSkip(skip int) *Query {
+	q.Skip = skip
+	return q
+}
+
+// 只返回指定字段
+func (q *Query) Select(keys ...string) *Query {
+	q.Keys = append(q.Keys, keys...)
+	return q
+}
+
+// 同时返回 Pointer 字段指向的对象, 支持 "post.author" 形式
+func (q *Query) IncludeKeys(keys ...string) *Query {
+	q.Include = append(q.Include, keys...)
+	return q
+}
+
+func (q *Query) where() map[string]interface{} {
+	if q.Where == nil {
+		q.Where = make(map[string]interface{})
+	}
+	return q.Where
+}
+
+// 为字段添加条件, 字段已是等值条件时会被覆盖
+func (q *Query) addCondition(key, op string, value interface{}) *Query {
+	where := q.where()
+	cond, ok := where[key].(map[string]interface{})
+	if !ok || cond["__type"] != nil {
+		cond = make(map[string]interface{})
+		where[key] = cond
+	}
+	cond[op] = value
+	return q
+}
+
+// 查询在 JSON 中的编码结构
+type queryJSON struct {
+	ClassName string                 `json:"className,omitempty"`
+	Where     map[string]interface{} `json:"where,omitempty"`
+	Order     string                 `json:"order,omitempty"`
+	Limit     int                    `json:"limit,omitempty"`
+	Skip      int                    `json:"skip,omitempty"`
+	Keys      string                 `json:"keys,omitempty"`
+	Include   string                 `json:"include,omitempty"`
+}
+
+func (q *Query) MarshalJSON() ([]byte, error) {
+	return json.Marshal(queryJSON{
+		ClassName: q.ClassName,
+		Where:     q.Where,
+		Order:     strings.Join(q.Order, ","),
+		Limit:     q.Limit,
+		Skip:      q.Skip,
+		Keys:      strings.Join(q.Keys, ","),
+		Include:   strings.Join(q.Include, ","),
+	})
+}
+
+func (q *Query) UnmarshalJSON(b []byte) error {
+	var v queryJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*q = Query{
+		ClassName: v.ClassName,
+		Where:     DecodeData(v.Where),
+		Order:     splitList(v.Order),
+		Limit:     v.Limit,
+		Skip:      v.Skip,
+		Keys:      splitList(v.Keys),
+		Include:   splitList(v.Include),
+	}
+	if q.Where == nil {
+		q.Where = make(map[string]interface{})
+	}
+	return nil
+}
+
+// 编码为数据 API 的 URL 查询参数, where 为 JSON 字符串
+func (q *Query) Values() (url.Values, error) {
+	values := url.Values{}
+	if len(q.Where) > 0 {
+		where, err := json.Marshal(q.Where)
+		if err != nil {
+			return nil, err
+		}
+		values.Set("where", string(where))
+	}
+	if len(q.Order) > 0 {
+		values.Set("order", strings.Join(q.Order, ","))
+	}
+	if q.Limit > 0 {
+		values.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.Skip > 0 {
+		values.Set("skip", strconv.Itoa(q.Skip))
+	}
+	if len(q.Keys) > 0 {
+		values.Set("keys", strings.Join(q.Keys, ","))
+	}
+	if len(q.Include) > 0 {
+		values.Set("include", strings.Join(q.Include, ","))
+	}
+	return values, nil
+}
+
+// 从数据 API 的 URL 查询参数解析查询
+func ParseQuery(className string, values url.Values) (*Query, error) {
+	q := NewQuery(className)
+	if where := values.Get("where"); where != "" {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(where), &m); err != nil {
+			return nil, fmt.Errorf("where 参数不是有效的 JSON: %v", err)
+		}
+		q.Where = DecodeData(m)
+	}
+	var err error
+	if limit := values.Get("limit"); limit != "" {
+		if q.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, fmt.Errorf("limit 参数无效: %q", limit)
+		}
+	}
+	if skip := values.Get("skip"); skip != "" {
+		if q.Skip, err = strconv.Atoi(skip); err != nil {
+			return nil, fmt.Errorf("skip 参数无效: %q", skip)
+		}
+	}
+	q.Order = splitList(values.Get("order"))
+	q.Keys = splitList(values.Get("keys"))
+	q.Include = splitList(values.Get("include"))
+	return q, nil
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// 查询结果
+type QueryResult struct {
+
+	// 返回的对象, 特殊类型字段已转换为 Date, Pointer 等类型
+	Results []map[string]interface{} `json:"results"`
+
+	// 符合条件的总数, 查询时要求返回总数才会有
+	Count int `json:"count,omitempty"`
+}
+
+func (r *QueryResult) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Results []map[string]interface{} `json:"results"`
+		Count   int                      `json:"count"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	r.Count = v.Count
+	r.Results = make([]map[string]interface{}, len(v.Results))
+	for i, obj := range v.Results {
+		r.Results[i] = DecodeData(obj)
+	}
+	return nil
+}
+
+// 将结果绑定到结构体切片, v 应为切片指针, 如 *[]Post
+func (r *QueryResult) Bind(v interface{}) error {
+	list := make([]interface{}, len(r.Results))
+	for i, obj := range r.Results {
+		list[i] = obj
+	}
+	b, err := json.Marshal(normalizeDates(list))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
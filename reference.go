@@ -0,0 +1,277 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// 被引用对象删除时的处理方式
+type DeleteRule string
+
+const (
+	DeleteCascade  DeleteRule = "cascade"  // 同时删除引用的对象
+	DeleteNullify  DeleteRule = "nullify"  // 删除引用对象上的引用字段
+	DeleteRestrict DeleteRule = "restrict" // 仍被引用时不允许删除
+)
+
+// 表之间的引用: ClassName 表的 Field 字段为指向 Target 表的 Pointer
+type Reference struct {
+	ClassName string
+	Field     string
+	Target    string
+
+	// Target 对象删除时的处理方式, 为空时按 DeleteRestrict
+	OnDelete DeleteRule
+}
+
+func (ref Reference) rule() DeleteRule {
+	if ref.OnDelete == "" {
+		return DeleteRestrict
+	}
+	return ref.OnDelete
+}
+
+// 声明表之间的引用, 需要同时设置 Registry.DataAPI:
+//
+//	registry.References(
+//		types.Reference{ClassName: "Comment", Field: "post", Target: "Post", OnDelete: types.DeleteCascade},
+//		types.Reference{ClassName: "Post", Field: "author", Target: "User", OnDelete: types.DeleteRestrict},
+//	)
+//	registry.DataAPI = client.AsMaster()
+//
+// Target 的 beforeDelete 钩子检查 DeleteRestrict 的引用, 仍被引用时返回 ErrCodeReferenced 错误;
+// afterDelete 钩子执行 DeleteCascade 及 DeleteNullify, 此时不再查询 DeleteRestrict 的引用, 执行失败只记录在 Logs 中.
+// 级联删除的对象上的引用同样会被处理.
+//
+// 级联删除及删除引用字段直接通过 DataAPI 执行, 不会调用本 Registry 中级联表的钩子;
+// 是否执行这些表的钩子取决于 DataAPI(如 API 服务器的配置), MemoryStore 不执行任何钩子.
+func (r *Registry) References(refs ...Reference) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refs = append(r.refs, refs...)
+}
+
+// 指向表 target 的引用, 按声明顺序
+func (r *Registry) referencesTo(target string) []Reference {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var refs []Reference
+	for _, ref := range r.refs {
+		if ref.Target == target {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// 删除计划中的一项
+type DeleteAction struct {
+	Rule      DeleteRule `json:"rule"`
+	ClassName string     `json:"className"`
+	ObjectId  string     `json:"objectId"`
+
+	// 引用字段
+	Field string `json:"field"`
+
+	// 被引用的对象, 如 "Post/abc"
+	Parent string `json:"parent"`
+}
+
+func (a DeleteAction) String() string {
+	return fmt.Sprintf("%s %s/%s.%s -> %s", a.Rule, a.ClassName, a.ObjectId, a.Field, a.Parent)
+}
+
+// 删除一个对象时受影响的对象. 由 PlanDelete 生成, 不执行任何修改, 可用于预览
+type DeletePlan struct {
+	ClassName string         `json:"className"`
+	ObjectId  string         `json:"objectId"`
+	Actions   []DeleteAction `json:"actions"`
+}
+
+// 阻止删除的引用
+func (p *DeletePlan) Restricted() []DeleteAction {
+	var list []DeleteAction
+	for _, a := range p.Actions {
+		if a.Rule == DeleteRestrict {
+			list = append(list, a)
+		}
+	}
+	return list
+}
+
+// 有阻止删除的引用时返回 ErrCodeReferenced 错误
+func (p *DeletePlan) Err() error {
+	restricted := p.Restricted()
+	if len(restricted) == 0 {
+		return nil
+	}
+	a := restricted[0]
+	msg := fmt.Sprintf("%s/%s 仍被 %s/%s 的 %s 字段引用", p.ClassName, p.ObjectId, a.ClassName, a.ObjectId, a.Field)
+	if len(restricted) > 1 {
+		msg += fmt.Sprintf(" 等 %d 个对象", len(restricted))
+	}
+	return CloudError{Code: ErrCodeReferenced, Message: msg}
+}
+
+// 每项一行
+func (p *DeletePlan) String() string {
+	lines := make([]string, len(p.Actions))
+	for i, a := range p.Actions {
+		lines[i] = a.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// 执行计划: 先删除引用字段, 再从最深一层开始删除级联的对象; 不删除 ClassName/ObjectId 本身.
+// 对象已不存在时忽略. 有阻止删除的引用时不执行, 返回 Err 的错误
+func (p *DeletePlan) Apply(ctx context.Context, api DataAPI) error {
+	if err := p.Err(); err != nil {
+		return err
+	}
+	return p.apply(ctx, api)
+}
+
+// 执行级联删除及删除引用字段, 不检查 DeleteRestrict
+func (p *DeletePlan) apply(ctx context.Context, api DataAPI) error {
+	for _, a := range p.Actions {
+		if a.Rule != DeleteNullify {
+			continue
+		}
+		_, err := api.Save(ctx, a.ClassName, a.ObjectId, map[string]interface{}{a.Field: NewDelete()})
+		if err != nil && !isNotFound(err) {
+			return fmt.Errorf("%s: %v", a, err)
+		}
+	}
+	for i := len(p.Actions) - 1; i >= 0; i-- {
+		a := p.Actions[i]
+		if a.Rule != DeleteCascade {
+			continue
+		}
+		if err := api.Delete(ctx, a.ClassName, a.ObjectId); err != nil && !isNotFound(err) {
+			return fmt.Errorf("%s: %v", a, err)
+		}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	cerr, ok := err.(CloudError)
+	return ok && cerr.Code == ErrCodeNotFound
+}
+
+// 每次查询引用对象的条数
+const referencePageSize = 500
+
+// 通过 DataAPI 查询引用了对象的所有对象, 生成删除计划(dry-run), 不做任何修改.
+// 级联删除的对象会继续查询其引用, 每个对象只出现一次
+func (r *Registry) PlanDelete(ctx context.Context, className, objectId string) (*DeletePlan, error) {
+	if r.DataAPI == nil {
+		return nil, fmt.Errorf("未设置 DataAPI")
+	}
+	return r.planDelete(ctx, className, objectId, true)
+}
+
+// restrict 为 false 时不查询 DeleteRestrict 的引用, 用于对象已删除后执行计划
+func (r *Registry) planDelete(ctx context.Context, className, objectId string, restrict bool) (*DeletePlan, error) {
+	plan := &DeletePlan{ClassName: className, ObjectId: objectId}
+	visited := map[string]bool{className + "/" + objectId: true}
+	if err := r.walkReferences(ctx, plan, className, objectId, visited, restrict); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (r *Registry) walkReferences(ctx context.Context, plan *DeletePlan, className, objectId string, visited map[string]bool, restrict bool) error {
+	parent := className + "/" + objectId
+	for _, ref := range r.referencesTo(className) {
+		if !restrict && ref.rule() == DeleteRestrict {
+			continue
+		}
+		ids, err := findReferencing(ctx, r.DataAPI, ref, objectId)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			key := ref.ClassName + "/" + id
+			if ref.rule() == DeleteCascade && visited[key] {
+				continue
+			}
+			plan.Actions = append(plan.Actions, DeleteAction{Rule: ref.rule(), ClassName: ref.ClassName, ObjectId: id, Field: ref.Field, Parent: parent})
+			if ref.rule() == DeleteCascade {
+				visited[key] = true
+				if err := r.walkReferences(ctx, plan, ref.ClassName, id, visited, restrict); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func findReferencing(ctx context.Context, api DataAPI, ref Reference, objectId string) ([]string, error) {
+	var ids []string
+	for skip := 0; ; skip += referencePageSize {
+		q := NewQuery(ref.ClassName).EqualTo(ref.Field, NewPointer(ref.Target, objectId)).Ascending("objectId").Select("objectId")
+		q.Limit = referencePageSize
+		q.Skip = skip
+		res, err := api.Find(ctx, q)
+		if err != nil {
+			return nil, fmt.Errorf("查询 %s.%s 的引用失败: %v", ref.ClassName, ref.Field, err)
+		}
+		for _, obj := range res.Results {
+			if id, _ := obj["objectId"].(string); id != "" {
+				ids = append(ids, id)
+			}
+		}
+		if len(res.Results) < referencePageSize {
+			return ids, nil
+		}
+	}
+}
+
+// 钩子调用参数中的对象 Id
+func hookObjectId(req *CloudRequest) string {
+	if req.ObjectId != "" {
+		return req.ObjectId
+	}
+	id, _ := req.Data["objectId"].(string)
+	return id
+}
+
+// beforeDelete: 有 DeleteRestrict 的引用时返回失败, 否则返回 nil
+func (r *Registry) checkReferences(ctx context.Context, className string, req *CloudRequest) *CloudeResponse {
+	objectId := hookObjectId(req)
+	if r.DataAPI == nil || objectId == "" || len(r.referencesTo(className)) == 0 {
+		return nil
+	}
+	plan, err := r.PlanDelete(ctx, className, objectId)
+	if err != nil {
+		return Fail(ErrCodeCloudFailure, err.Error())
+	}
+	if err := plan.Err(); err != nil {
+		return FailWith(err)
+	}
+	return nil
+}
+
+// afterDelete: 执行级联删除及删除引用字段, 结果记录在 res.Logs 中
+func (r *Registry) applyReferences(ctx context.Context, className string, req *CloudRequest, res *CloudeResponse) {
+	objectId := hookObjectId(req)
+	if r.DataAPI == nil || objectId == "" || len(r.referencesTo(className)) == 0 {
+		return
+	}
+	// 对象已经删除, DeleteRestrict 的检查已在 beforeDelete 中完成, 不再查询
+	plan, err := r.planDelete(ctx, className, objectId, false)
+	if err != nil {
+		res.AddLog(ctx, "reference", "处理引用失败: "+err.Error())
+		return
+	}
+	if err := plan.apply(ctx, r.DataAPI); err != nil {
+		res.AddLog(ctx, "reference", "处理引用失败: "+err.Error())
+		return
+	}
+	if n := len(plan.Actions); n > 0 {
+		res.AddLog(ctx, "reference", fmt.Sprintf("处理了 %d 个引用对象", n))
+	}
+}
@@ -0,0 +1,417 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 钩子类型
+type HookType string
+
+const (
+	BeforeSave   HookType = "beforeSave"
+	AfterSave    HookType = "afterSave"
+	BeforeDelete HookType = "beforeDelete"
+	AfterDelete  HookType = "afterDelete"
+
+	// 查询返回前处理结果列表, 见 CloudRequest.Objects 及 CloudeResponse.Objects
+	AfterFind HookType = "afterFind"
+)
+
+// 云代码的调用入口, Registry 和 Router 都实现了此接口, 各种传输方式(HTTP, stdio 等)都基于它分发调用
+type Handler interface {
+
+	// 调用云函数
+	Call(ctx context.Context, name string, req *CloudRequest) *CloudeResponse
+
+	// 执行表上的钩子
+	RunHook(ctx context.Context, className string, hook HookType, req *CloudRequest) *CloudeResponse
+}
+
+// 云函数及钩子的注册表, 对应一个应用
+type Registry struct {
+
+	// 应用的配置, 调用时若 CloudRequest.App.Config 为空, 处理函数看到的 App.Config 为此配置
+	Config map[string]interface{}
+
+	// 同一钩子有多个处理函数时, 修改同一字段的处理方式
+	ConflictPolicy ConflictPolicy
+
+	// afterSave 及 afterDelete 钩子成功执行后发布事件的总线, 为 nil 时不发布
+	Events *EventBus
+
+	// afterSave 及 afterDelete 处理函数失败时的重试策略, 为 nil 时不重试.
+	// NOTE: 重试在钩子调用中同步进行, 会推迟钩子的返回; 耗时的副作用请使用 Events
+	Retry *RetryPolicy
+
+	// 重试后仍然失败的 afterSave 及 afterDelete 调用保存于此, 可以用 Replay 重放. 为 nil 时不保存
+	DeadLetters DeadLetterStore
+
+	// 调用时放入 ctx 的时钟(见 ClockFrom), 为 nil 时不设置
+	Clock Clock
+
+	// 处理表之间的引用(见 References)时访问数据 API, 一般为 Master 权限的 DataClient, 为 nil 时不处理
+	DataAPI DataAPI
+
+	mu        sync.RWMutex
+	functions map[string]CloudFunc
+	streams   map[string]StreamFunc
+	specs     map[string]FunctionSpec
+	hooks     map[string][]CloudFunc
+	auditors  map[string]*Auditor
+	hides     map[string][]string
+	virtuals  map[string][]virtualField
+	rules     map[string]FieldRules
+	refs      []Reference
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		functions: make(map[string]CloudFunc),
+		streams:   make(map[string]StreamFunc),
+		specs:     make(map[string]FunctionSpec),
+		hooks:     make(map[string][]CloudFunc),
+		auditors:  make(map[string]*Auditor),
+		hides:     make(map[string][]string),
+		virtuals:  make(map[string][]virtualField),
+		rules:     make(map[string]FieldRules),
+	}
+}
+
+// 定义云函数, 同名函数会被覆盖
+func (r *Registry) Define(name string, fn CloudFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.functions[name] = fn
+	delete(r.streams, name)
+}
+
+// 定义流式云函数, 同名函数会被覆盖.
+// 以流式方式调用时逐条发送结果; 以普通方式(Call)调用时结果收集为数组放入 Result
+func (r *Registry) DefineStream(name string, fn StreamFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streams[name] = fn
+	delete(r.functions, name)
+}
+
+// 为表添加钩子处理函数, 同一钩子可以添加多个, 按添加顺序执行后合并结果
+func (r *Registry) Hook(className string, hook HookType, fn CloudFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := hookKey(className, hook)
+	r.hooks[key] = append(r.hooks[key], fn)
+}
+
+// 读取云函数
+func (r *Registry) Function(name string) (CloudFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.functions[name]
+	return fn, ok
+}
+
+// 读取流式云函数
+func (r *Registry) StreamFunction(name string) (StreamFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fn, ok := r.streams[name]
+	return fn, ok
+}
+
+// 读取钩子处理函数
+func (r *Registry) Hooks(className string, hook HookType) []CloudFunc {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]CloudFunc(nil), r.hooks[hookKey(className, hook)]...)
+}
+
+// 所有云函数的名称, 按名称排序
+func (r *Registry) FunctionNames() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.functions)+len(r.streams))
+	for name := range r.functions {
+		names = append(names, name)
+	}
+	for name := range r.streams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *Registry) Call(ctx context.Context, name string, req *CloudRequest) *CloudeResponse {
+	if fn, ok := r.StreamFunction(name); ok {
+		ctx, req = r.prepare(ctx, req)
+		w := &collectWriter{}
+		res := invokeStream(ctx, fn, req, w)
+		if res.Successed {
+			res.Result = w.items
+		}
+		return res
+	}
+	fn, ok := r.Function(name)
+	if !ok {
+		return Fail(ErrCodeNotFound, fmt.Sprintf("云函数不存在: %s", name))
+	}
+	ctx, req = r.prepare(ctx, req)
+	return invoke(ctx, fn, req)
+}
+
+// 流式调用云函数. 普通云函数的 Result 为数组时逐条写入, 否则作为一条结果写入
+func (r *Registry) Stream(ctx context.Context, name string, req *CloudRequest, w ResultWriter) *CloudeResponse {
+	if fn, ok := r.StreamFunction(name); ok {
+		ctx, req = r.prepare(ctx, req)
+		res := invokeStream(ctx, fn, req, w)
+		return &CloudeResponse{Successed: res.Successed, Errors: res.Errors, Logs: res.Logs}
+	}
+	fn, ok := r.Function(name)
+	if !ok {
+		return Fail(ErrCodeNotFound, fmt.Sprintf("云函数不存在: %s", name))
+	}
+	ctx, req = r.prepare(ctx, req)
+	res := invoke(ctx, fn, req)
+	if res.Successed {
+		if err := writeResult(w, res.Result); err != nil {
+			failed := Fail(ErrCodeInternal, err.Error())
+			failed.Logs = res.Logs
+			return failed
+		}
+	}
+	return &CloudeResponse{Successed: res.Successed, Errors: res.Errors, Logs: res.Logs}
+}
+
+// 依次执行所有处理函数并按 ConflictPolicy 合并结果; 没有处理函数时返回成功.
+// beforeSave 时先应用表的字段规则(见 Rules), 规则的修改与处理函数的返回一起写入 Data.
+// beforeDelete 及 afterDelete 时处理表之间的引用(见 References).
+// 表开启了审计(见 EnableAudit)时, 成功后写入审计记录; 设置了 Events 时发布事件.
+// 两者失败都只记录在 Logs 中
+func (r *Registry) RunHook(ctx context.Context, className string, hook HookType, req *CloudRequest) *CloudeResponse {
+	ctx, req = r.prepare(ctx, req)
+	if hook == AfterFind {
+		return r.runAfterFind(ctx, className, req)
+	}
+	if hook == BeforeSave {
+		req = r.withoutVirtual(className, req)
+	}
+	var ruleChanges map[string]interface{}
+	var ruleNotes []string
+	if rules, ok := r.fieldRules(className); ok && hook == BeforeSave {
+		var err error
+		if ruleChanges, ruleNotes, err = rules.Apply(req); err != nil {
+			return FailWith(err)
+		}
+		// 处理函数看到的是应用规则后的 Data, 不修改调用方的 req
+		if len(ruleChanges) > 0 {
+			copied := *req
+			copied.Data = copyObject(req.Data)
+			for k, v := range ruleChanges {
+				copied.Data[k] = v
+			}
+			req = &copied
+		}
+	}
+
+	if hook == BeforeDelete {
+		if res := r.checkReferences(ctx, className, req); res != nil {
+			return res
+		}
+	}
+
+	after := hook == AfterSave || hook == AfterDelete
+	var responses []*CloudeResponse
+	for i, fn := range r.Hooks(className, hook) {
+		var res *CloudeResponse
+		if after && (r.Retry != nil || r.DeadLetters != nil) {
+			res = r.invokeAfterHook(ctx, className, hook, i, fn, req)
+		} else {
+			res = invoke(ctx, fn, req)
+		}
+		responses = append(responses, res)
+		if !res.Successed {
+			break
+		}
+	}
+	merged, err := MergeResponses(r.ConflictPolicy, responses...)
+	if err != nil {
+		// 保留合并错误的 Code 及 Message, 以及各处理函数的 Logs
+		failed := FailWith(err)
+		for _, res := range responses {
+			failed.Logs = append(failed.Logs, res.Logs...)
+		}
+		return failed
+	}
+	if len(ruleChanges) > 0 && merged.Successed {
+		// 处理函数返回的修改优先
+		data := ruleChanges
+		for k, v := range merged.Data {
+			data[k] = v
+		}
+		merged.Data = data
+		merged.AddLog(ctx, "rules", "字段规则: "+strings.Join(ruleNotes, "; "))
+	}
+	if hook == BeforeSave {
+		r.protectVirtual(className, merged)
+		if merged.Successed {
+			r.rememberHide(className, merged.Hide)
+		}
+	}
+	if hook == AfterDelete {
+		// 对象已删除, 处理函数失败也要处理引用
+		r.applyReferences(ctx, className, req, merged)
+	}
+	if a := r.auditor(className); a != nil && merged.Successed && a.audits(hook) {
+		if err := a.record(ctx, className, hook, req, r.auditHide(className, merged)); err != nil {
+			merged.AddLog(ctx, "audit", "审计记录写入失败: "+err.Error())
+		}
+	}
+	if r.Events != nil && merged.Successed && after {
+		if err := r.Events.Publish(ctx, NewEvent(ctx, className, hook, req)); err != nil {
+			merged.AddLog(ctx, "event", "事件发布失败: "+err.Error())
+		}
+	}
+	return merged
+}
+
+// afterFind 先为每个对象计算虚拟字段, 再由处理函数依次处理对象列表: 后一个处理函数收到前一个返回的 Objects.
+// 最终的列表按所有处理函数返回的 Hide 隐藏字段
+func (r *Registry) runAfterFind(ctx context.Context, className string, req *CloudRequest) *CloudeResponse {
+	res := &CloudeResponse{Successed: true}
+	objects := req.Objects
+	if len(r.VirtualFields(className)) > 0 {
+		objects = make([]map[string]interface{}, len(req.Objects))
+		for i, obj := range req.Objects {
+			var logs []CloudLog
+			objects[i], logs = r.ComputeVirtual(ctx, className, req.Session, obj)
+			res.Logs = append(res.Logs, logs...)
+		}
+	}
+	for _, fn := range r.Hooks(className, AfterFind) {
+		call := *req
+		call.Objects = objects
+		out := invoke(ctx, fn, &call)
+		res.Logs = append(res.Logs, out.Logs...)
+		if !out.Successed {
+			failed := Fail(out.Errors.Code, out.Errors.Message)
+			failed.Logs = res.Logs
+			return failed
+		}
+		if out.Objects != nil {
+			objects = out.Objects
+		}
+		res.Hide = unionStrings(res.Hide, out.Hide)
+	}
+	res.Objects = res.ApplyHideList(objects)
+	return res
+}
+
+// 按 Retry 重试 after 钩子的处理函数, 仍然失败时保存为死信
+func (r *Registry) invokeAfterHook(ctx context.Context, className string, hook HookType, index int, fn CloudFunc, req *CloudRequest) *CloudeResponse {
+	original := *req
+	original.Data = copyObject(req.Data)
+	original.Previous = copyObject(req.Previous)
+
+	policy := RetryPolicy{Attempts: 1}
+	if r.Retry != nil {
+		policy = *r.Retry
+	}
+	var res *CloudeResponse
+	attempts, _ := policy.Do(ctx, func() error {
+		res = invoke(ctx, fn, req)
+		if !res.Successed {
+			return res.Errors
+		}
+		return nil
+	})
+	if res.Successed || r.DeadLetters == nil {
+		return res
+	}
+
+	dl := &DeadLetter{
+		Id:        newDeadLetterId(),
+		Kind:      DeadLetterHook,
+		Handler:   handlerName(hookKey(className, hook), index),
+		ClassName: className,
+		Hook:      hook,
+		Request:   original,
+		Error:     res.Errors.Error(),
+		Attempts:  attempts,
+		FailedAt:  ClockFrom(ctx).Now(),
+	}
+	if err := r.DeadLetters.Add(dl); err != nil {
+		res.AddLog(ctx, "retry", "死信保存失败: "+err.Error())
+	} else {
+		res.AddLog(ctx, "retry", fmt.Sprintf("尝试 %d 次后仍然失败, 已保存为死信 %s", attempts, dl.Id))
+	}
+	return res
+}
+
+// 重放 DeadLetters 中的死信: 只执行失败的那个处理函数(或订阅者), 不重试.
+// 成功后删除死信, 失败时更新死信的 Attempts 及 Error 并返回错误.
+// 事件订阅者的死信交给 Events 重放, 使用 Events.DeadLetters
+func (r *Registry) Replay(ctx context.Context, id string) error {
+	if r.DeadLetters == nil {
+		return fmt.Errorf("未设置死信存储")
+	}
+	dl, err := r.DeadLetters.Get(id)
+	if err != nil {
+		return err
+	}
+	if dl.Kind == DeadLetterEvent {
+		if r.Events == nil {
+			return fmt.Errorf("未设置事件总线, 无法重放死信 %s", id)
+		}
+		return r.Events.Replay(ctx, id)
+	}
+
+	key, index, err := parseHandlerName(dl.Handler)
+	if err != nil {
+		return err
+	}
+	hooks := r.Hooks(dl.ClassName, dl.Hook)
+	if key != hookKey(dl.ClassName, dl.Hook) || index >= len(hooks) {
+		return fmt.Errorf("处理函数不存在: %s", dl.Handler)
+	}
+	req := dl.Request
+	ctx, prepared := r.prepare(ctx, &req)
+	var callErr error
+	if res := invoke(ctx, hooks[index], prepared); !res.Successed {
+		callErr = res.Errors
+	}
+	return finishReplay(r.DeadLetters, dl, callErr, ClockFrom(ctx).Now())
+}
+
+// 调用前的准备. App.Config 为空时返回填入 r.Config 的副本, 不修改调用方的 req
+func (r *Registry) prepare(ctx context.Context, req *CloudRequest) (context.Context, *CloudRequest) {
+	if req.App.Config == nil && r.Config != nil {
+		copied := *req
+		copied.App.Config = r.Config
+		req = &copied
+	}
+	if r.Clock != nil {
+		ctx = WithClock(ctx, r.Clock)
+	}
+	return ctx, req
+}
+
+// 调用处理函数, 捕获 panic, 返回 nil 时视为成功
+func invoke(ctx context.Context, fn CloudFunc, req *CloudRequest) (res *CloudeResponse) {
+	defer func() {
+		if err := recover(); err != nil {
+			res = Fail(ErrCodeCloudFailure, fmt.Sprintf("云代码执行出错: %v", err))
+		}
+	}()
+	res = fn(ctx, req)
+	if res == nil {
+		res = &CloudeResponse{Successed: true}
+	}
+	return
+}
+
+func hookKey(className string, hook HookType) string {
+	return className + "." + string(hook)
+}
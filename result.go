@@ -0,0 +1,85 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// 将返回强类型结果的函数包装为 CloudFunc, 返回值放入 CloudeResponse.Result:
+//
+//	registry.Define("getOrder", types.Respond(func(ctx context.Context, req *types.CloudRequest) (*Order, error) {
+//		...
+//	}))
+//
+// 返回的 error 为 CloudError 时保留其错误码, 其他错误的错误码为 ErrCodeCloudFailure.
+func Respond[T any](fn func(ctx context.Context, req *CloudRequest) (T, error)) CloudFunc {
+	return func(ctx context.Context, req *CloudRequest) *CloudeResponse {
+		v, err := fn(ctx, req)
+		if err != nil {
+			return FailWith(err)
+		}
+		return &CloudeResponse{Successed: true, Result: v}
+	}
+}
+
+// 由 error 创建失败的返回结构, error 为 CloudError 时保留其错误码
+func FailWith(err error) *CloudeResponse {
+	var cerr CloudError
+	if errors.As(err, &cerr) {
+		return Fail(cerr.Code, cerr.Message)
+	}
+	var perr *CloudError
+	if errors.As(err, &perr) && perr != nil {
+		return Fail(perr.Code, perr.Message)
+	}
+	return Fail(ErrCodeCloudFailure, err.Error())
+}
+
+// 将 CloudeResponse.Result 解码为 T.
+// 调用失败时返回 CloudError; Result 的结构与 T 不一致时返回 *ResultTypeError.
+func DecodeResult[T any](res *CloudeResponse) (T, error) {
+	var v T
+	if res == nil {
+		return v, CloudError{Code: ErrCodeInternal, Message: "返回结构为空"}
+	}
+	if !res.Successed {
+		return v, res.Errors
+	}
+	if res.Result == nil {
+		return v, nil
+	}
+	// 进程内调用时 Result 就是 T
+	if t, ok := res.Result.(T); ok {
+		return t, nil
+	}
+	b, err := json.Marshal(res.Result)
+	if err != nil {
+		return v, &ResultTypeError{Type: reflect.TypeOf(&v).Elem(), Err: err}
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, &ResultTypeError{Type: reflect.TypeOf(&v).Elem(), Err: err}
+	}
+	return v, nil
+}
+
+// 调用云函数并将结果解码为 T
+func CallResult[T any](ctx context.Context, h Handler, name string, req *CloudRequest) (T, error) {
+	return DecodeResult[T](h.Call(ctx, name, req))
+}
+
+// CloudeResponse.Result 无法解码为指定类型
+type ResultTypeError struct {
+	Type reflect.Type
+	Err  error
+}
+
+func (e *ResultTypeError) Error() string {
+	return fmt.Sprintf("CloudeResponse.Result 无法解码为 %s: %v", e.Type, e.Err)
+}
+
+func (e *ResultTypeError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// 重试策略: 指数退避加随机抖动
+type RetryPolicy struct {
+
+	// 总尝试次数(包括第一次), 小于等于 1 时不重试
+	Attempts int
+
+	// 第一次重试前的等待时间
+	InitialBackoff time.Duration
+
+	// 等待时间上限, 为 0 时不限制
+	MaxBackoff time.Duration
+
+	// 每次重试等待时间的倍数, 小于 1 时按 2 计算
+	Multiplier float64
+
+	// 抖动比例(0 ~ 1), 实际等待时间在 [d*(1-Jitter), d*(1+Jitter)] 之间, 避免同时重试
+	Jitter float64
+}
+
+// 默认重试策略: 共 3 次, 等待 200ms, 400ms, 抖动 20%
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:       3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     10 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// 第 attempt 次重试(从 1 开始)前的等待时间
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// 执行 fn, 返回错误时按策略重试. 返回尝试的次数及最后一次的错误; ctx 结束时停止等待并返回 ctx 的错误
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) (attempts int, err error) {
+	for {
+		attempts++
+		if err = fn(); err == nil || attempts >= p.Attempts {
+			return
+		}
+		timer := time.NewTimer(p.Backoff(attempts))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return attempts, ctx.Err()
+		}
+	}
+}
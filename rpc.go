@@ -1,6 +1,8 @@
 // API服务器同云代码服务器交互协议
 package types
 
+import "fmt"
+
 // 云代码Session
 type CloudSession struct {
 
@@ -15,6 +17,27 @@ type CloudSession struct {
 
 	// 用户状态
 	Disabled bool `json:"disabled"`
+
+	// 登录方式, 如 AuthPassword
+	AuthProvider string `json:"authProvider,omitempty"`
+
+	// 登录方式下的用户标识, 如微信 openid, unionid 或手机号
+	AuthId string `json:"authId,omitempty"`
+
+	// 发起调用的安装(设备)Id
+	InstallationId string `json:"installationId,omitempty"`
+
+	// 设备类型, 如 ios, android, web
+	DeviceType string `json:"deviceType,omitempty"`
+
+	// Session Token 的过期时间, 格式同 DateLayout, 为空表示不过期
+	ExpiresAt string `json:"expiresAt,omitempty"`
+
+	// 是否为 Master 权限的代码以其他用户身份调用, 见 AsUser
+	Impersonated bool `json:"impersonated,omitempty"`
+
+	// 发起代用户调用的用户Id, 以 Master Key 调用时为空
+	ImpersonatorId string `json:"impersonatorId,omitempty"`
 }
 
 type CloudError struct {
@@ -22,6 +45,10 @@ type CloudError struct {
 	Message string `json:"message"`
 }
 
+func (e CloudError) Error() string {
+	return fmt.Sprintf("cloud error %d: %s", e.Code, e.Message)
+}
+
 type CloudLog struct {
 	CreatedAt string `json:"createdAt"`
 	Content   string `json:"content"`
@@ -44,8 +71,21 @@ type CloudRequest struct {
 	// 用户操作时的Session对象
 	Session CloudSession `json:"session"`
 
+	// 调用所属的应用及运行环境
+	App AppContext `json:"app"`
+
 	// 更新/删除前的对象
 	Previous map[string]interface{} `json:"previous"`
+
+	// afterFind 钩子: 查询返回的对象列表
+	Objects []map[string]interface{} `json:"objects,omitempty"`
+
+	// afterFind 钩子: 查询条件
+	Query *Query `json:"query,omitempty"`
+
+	// 幂等键, 可选.
+	// 客户端重试时带上相同的值, 有效期内同一用户的重复调用直接返回首次结果
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
 }
 
 // 云代码条用后返回结构
@@ -60,6 +100,9 @@ type CloudeResponse struct {
 	// 调用函数时返回的数据
 	Result interface{} `json:"result"`
 
+	// afterFind 钩子处理后的对象列表, 为 nil 时表示不修改
+	Objects []map[string]interface{} `json:"objects,omitempty"`
+
 	// 额外字段, 如微信被动返回值, 直接编码友xml返回
 	ExtraData string `json:"extraData"`
 
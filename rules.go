@@ -0,0 +1,153 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 表的字段规则, 在 beforeSave 的处理函数之前自动执行, 修改写入 CloudeResponse.Data.
+// 字段名只支持顶层字段
+type FieldRules struct {
+
+	// 新建对象(没有 Previous)时, Data 中没有的字段使用默认值
+	Defaults map[string]interface{}
+
+	// 新建对象时写入 CloudSession.UserId 的字段名, 如 "createdBy"; 为空时不写入
+	CreatedBy string
+
+	// 每次保存时写入 CloudSession.UserId 的字段名, 如 "updatedBy"; 为空时不写入
+	UpdatedBy string
+
+	// 去掉首尾空白的字段
+	Trim []string
+
+	// 转换为小写的字段, 如 email
+	Lower []string
+
+	// 按 E.164 格式化的手机号字段, 如 +8613800138000
+	Phone []string
+
+	// 手机号没有国家码时使用的国家码, 如 "86"; 为空时没有国家码的号码视为错误
+	CountryCode string
+}
+
+// 为表设置字段规则, 覆盖之前的设置
+func (r *Registry) Rules(className string, rules FieldRules) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rules[className] = rules
+}
+
+func (r *Registry) fieldRules(className string) (FieldRules, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	rules, ok := r.rules[className]
+	return rules, ok
+}
+
+// 按规则计算 Data 的修改, 返回修改的字段及每个修改的说明; 手机号格式有误时返回 ErrCodeValidation 错误.
+// 不会修改 req
+func (rules FieldRules) Apply(req *CloudRequest) (changes map[string]interface{}, notes []string, err error) {
+	changes = make(map[string]interface{})
+	current := func(field string) (interface{}, bool) {
+		if v, ok := changes[field]; ok {
+			return v, true
+		}
+		v, ok := req.Data[field]
+		return v, ok
+	}
+	set := func(field string, v interface{}, note string) {
+		changes[field] = v
+		notes = append(notes, field+": "+note)
+	}
+
+	create := len(req.Previous) == 0
+	if create {
+		fields := make([]string, 0, len(rules.Defaults))
+		for field := range rules.Defaults {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if v, ok := req.Data[field]; !ok || v == nil {
+				set(field, rules.Defaults[field], "默认值")
+			}
+		}
+	}
+	if userId := req.Session.UserId; userId != "" {
+		if create && rules.CreatedBy != "" {
+			set(rules.CreatedBy, userId, "当前用户")
+		}
+		if rules.UpdatedBy != "" {
+			set(rules.UpdatedBy, userId, "当前用户")
+		}
+	}
+
+	for _, field := range rules.Trim {
+		if s, ok := stringField(current(field)); ok && strings.TrimSpace(s) != s {
+			set(field, strings.TrimSpace(s), "去掉首尾空白")
+		}
+	}
+	for _, field := range rules.Lower {
+		if s, ok := stringField(current(field)); ok && strings.ToLower(s) != s {
+			set(field, strings.ToLower(s), "转换为小写")
+		}
+	}
+	for _, field := range rules.Phone {
+		s, ok := stringField(current(field))
+		if !ok || s == "" {
+			continue
+		}
+		phone, perr := NormalizePhone(s, rules.CountryCode)
+		if perr != nil {
+			return nil, nil, CloudError{Code: ErrCodeValidation, Message: fmt.Sprintf("字段 %s: %v", field, perr)}
+		}
+		if phone != s {
+			set(field, phone, "格式化为 "+phone)
+		}
+	}
+	return changes, notes, nil
+}
+
+func stringField(v interface{}, ok bool) (string, bool) {
+	if !ok {
+		return "", false
+	}
+	s, ok := v.(string)
+	return s, ok
+}
+
+// 将手机号格式化为 E.164 格式(+国家码号码), 去掉空格, "-", "." 及括号.
+// 以 "+" 或 "00" 开头的号码视为带有国家码; 否则去掉开头的 "0" 后加上 countryCode
+func NormalizePhone(phone, countryCode string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '+' && b.Len() == 0:
+			b.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", fmt.Errorf("手机号 %q 包含无效字符", phone)
+		}
+	}
+	digits := b.String()
+	switch {
+	case strings.HasPrefix(digits, "+"):
+		digits = digits[1:]
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	default:
+		if countryCode == "" {
+			return "", fmt.Errorf("手机号 %q 缺少国家码", phone)
+		}
+		digits = strings.TrimPrefix(countryCode, "+") + strings.TrimLeft(digits, "0")
+	}
+	// E.164 号码最长 15 位, 国家码不以 0 开头
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", fmt.Errorf("手机号 %q 格式有误", phone)
+	}
+	return "+" + digits, nil
+}
@@ -0,0 +1,88 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+// 登录方式
+const (
+	AuthPassword      = "password"
+	AuthWeChatOpenId  = "wechat_openid"
+	AuthWeChatUnionId = "wechat_unionid"
+	AuthPhone         = "phone"
+	AuthAnonymous     = "anonymous"
+)
+
+// 返回以 userId 身份调用的 Session, 用于 Master 权限的代码按普通用户的权限访问数据.
+// 返回的 Session 没有 Master 权限, 角色为 roles, 并记录发起代用户调用的用户(Impersonated, ImpersonatorId).
+// 设备及过期时间沿用当前 Session; userId 不是当前用户时不保留登录方式.
+//
+// userId 为当前用户时保留 Disabled; 为其他用户时无法得知该用户的状态, Disabled 为 true(见 ACL),
+// 调用方确认该用户未被禁用后需要自行将 Disabled 设为 false:
+//
+//	u := req.Session.AsUser(userId, "member")
+//	u.Disabled = false // 已确认该用户未被禁用
+//	c := client.WithSession(u)
+func (s CloudSession) AsUser(userId string, roles ...string) CloudSession {
+	u := s
+	u.UserId = userId
+	u.Roles = roles
+	u.Master = false
+	if userId != s.UserId {
+		u.Disabled = true
+		u.AuthProvider = ""
+		u.AuthId = ""
+	}
+	if !s.Impersonated && (s.Master || userId != s.UserId) {
+		u.Impersonated = true
+		u.ImpersonatorId = s.UserId
+	}
+	return u
+}
+
+// 是否为未登录用户
+func (s CloudSession) IsAnonymous() bool {
+	return !s.Master && s.UserId == ""
+}
+
+// 是否拥有角色
+func (s CloudSession) HasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否以微信登录(openid 或 unionid)
+func (s CloudSession) IsWeChat() bool {
+	return s.AuthProvider == AuthWeChatOpenId || s.AuthProvider == AuthWeChatUnionId
+}
+
+// Session Token 的过期时间, 未设置或格式有误时 ok 为 false
+func (s CloudSession) Expires() (t time.Time, ok bool) {
+	if s.ExpiresAt == "" {
+		return time.Time{}, false
+	}
+	d, err := ParseDate(s.ExpiresAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return d.Time, true
+}
+
+// Session Token 是否已过期, 当前时间取自 ctx 中的时钟. Master 调用不会过期
+func (s CloudSession) Expired(ctx context.Context) bool {
+	if s.Master {
+		return false
+	}
+	t, ok := s.Expires()
+	return ok && !ClockFrom(ctx).Now().Before(t)
+}
+
+// 设置过期时间
+func (s *CloudSession) SetExpires(t time.Time) {
+	s.ExpiresAt = t.UTC().Format(DateLayout)
+}
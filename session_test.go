@@ -0,0 +1,27 @@
+package types
+
+import "testing"
+
+func TestAsUserDisabled(t *testing.T) {
+	s := CloudSession{UserId: "u1", Disabled: true}
+	if u := s.AsUser("u1"); !u.Disabled {
+		t.Fatal("被禁用的用户以自己身份调用时应保持禁用")
+	}
+	if u := (CloudSession{UserId: "u1"}).AsUser("u1"); u.Disabled {
+		t.Fatal("未禁用的用户以自己身份调用时不应被禁用")
+	}
+
+	master := CloudSession{Master: true}
+	u := master.AsUser("u2", "member")
+	if !u.Disabled || u.Master || !u.Impersonated {
+		t.Fatalf("以其他用户身份调用时默认为禁用且没有 Master 权限: %+v", u)
+	}
+	acl := ACL{"u2": {Read: true}}
+	if acl.CanRead(u) {
+		t.Fatal("禁用的 Session 不应有用户权限")
+	}
+	u.Disabled = false
+	if !acl.CanRead(u) {
+		t.Fatal("调用方启用后应有用户权限")
+	}
+}
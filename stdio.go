@@ -0,0 +1,205 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// 以子进程方式运行云代码: 在标准输入输出上交换 JSON-RPC 2.0 消息, 每条消息一行.
+// NOTE: 标准输出被协议占用, 云代码的调试输出请写到标准错误.
+//
+// 标准输入关闭或收到 $/shutdown 后不再接收新的调用, 等待进行中的调用完成后返回;
+// ctx 取消时同样等待进行中的调用完成. 无法解析的行返回 RPCParseError 错误后继续读取.
+// 返回时若 in 实现了 io.Closer 则将其关闭, 否则读取协程会阻塞到 in 有数据或结束为止.
+func ServeStdio(ctx context.Context, h Handler, in io.Reader, out io.Writer) error {
+	var wmu sync.Mutex
+	enc := json.NewEncoder(out)
+	send := func(msg *rpcMessage) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		return enc.Encode(msg)
+	}
+	server := newRPCServer(h, send)
+	defer server.wait()
+
+	if c, ok := in.(io.Closer); ok {
+		// 结束阻塞在读取上的协程
+		defer c.Close()
+	}
+
+	lines := make(chan []byte)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		r := bufio.NewReader(in)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(bytes.TrimSpace(line)) > 0 {
+				select {
+				case lines <- line:
+				case <-done:
+					return
+				}
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case line := <-lines:
+			var msg rpcMessage
+			if err := json.Unmarshal(line, &msg); err != nil {
+				// 无法解析的行不影响后续的调用
+				server.reply(nil, nil, &RPCError{Code: RPCParseError, Message: err.Error()})
+				continue
+			}
+			if server.handle(ctx, &msg) {
+				return nil
+			}
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// 在当前进程的标准输入输出上提供云代码服务, 用于云代码子进程的 main 函数
+func ServeStdioMain(h Handler) error {
+	return ServeStdio(context.Background(), h, os.Stdin, os.Stdout)
+}
+
+// API 服务器一侧的 stdio 客户端, 通过子进程的标准输入输出调用云代码.
+// 实现了 Handler, 可以并发调用.
+type StdioClient struct {
+	rpc *rpcClient
+	in  io.WriteCloser
+	cmd *exec.Cmd
+}
+
+// 基于已有的管道创建客户端, out 为子进程的标准输出, in 为子进程的标准输入
+func NewStdioClient(out io.Reader, in io.WriteCloser) *StdioClient {
+	c := &StdioClient{in: in}
+	c.start(out)
+	return c
+}
+
+// 启动云代码子进程并创建客户端. 子进程退出时所有进行中的调用返回错误, Done 被关闭
+func StartStdio(cmd *exec.Cmd) (*StdioClient, error) {
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := &StdioClient{in: in, cmd: cmd}
+	c.start(out)
+	return c, nil
+}
+
+func (c *StdioClient) start(out io.Reader) {
+	var wmu sync.Mutex
+	enc := json.NewEncoder(c.in)
+	c.rpc = newRPCClient(func(msg *rpcMessage) error {
+		wmu.Lock()
+		defer wmu.Unlock()
+		return enc.Encode(msg)
+	})
+
+	go func() {
+		dec := json.NewDecoder(out)
+		var err error
+		for {
+			var msg rpcMessage
+			if err = dec.Decode(&msg); err != nil {
+				break
+			}
+			c.rpc.deliver(&msg)
+		}
+		if err == io.EOF {
+			err = errRPCClosed
+		}
+		// 读完标准输出后才能调用 Wait
+		if c.cmd != nil {
+			if waitErr := c.cmd.Wait(); waitErr != nil {
+				err = fmt.Errorf("云代码进程退出: %v", waitErr)
+			} else {
+				err = fmt.Errorf("云代码进程退出")
+			}
+		}
+		c.rpc.fail(err)
+	}()
+}
+
+// 调用目标, 返回的错误为传输层错误(如进程已退出); 云代码的失败在 CloudeResponse 中
+func (c *StdioClient) Invoke(ctx context.Context, t Target, req *CloudRequest) (*CloudeResponse, error) {
+	return c.rpc.invoke(ctx, t, req)
+}
+
+func (c *StdioClient) Call(ctx context.Context, name string, req *CloudRequest) *CloudeResponse {
+	return responseOrFail(c.Invoke(ctx, FunctionTarget(name), req))
+}
+
+func (c *StdioClient) RunHook(ctx context.Context, className string, hook HookType, req *CloudRequest) *CloudeResponse {
+	return responseOrFail(c.Invoke(ctx, HookTarget(className, hook), req))
+}
+
+// 连接断开或子进程退出时关闭
+func (c *StdioClient) Done() <-chan struct{} {
+	return c.rpc.done
+}
+
+// 连接断开的原因, 连接正常时为 nil
+func (c *StdioClient) Err() error {
+	select {
+	case <-c.rpc.done:
+		return c.rpc.closeErr()
+	default:
+		return nil
+	}
+}
+
+// 优雅关闭: 通知云代码处理完进行中的调用后退出, 超过 timeout 仍未退出则杀死子进程
+func (c *StdioClient) Close(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	c.rpc.call(ctx, MethodShutdown, nil)
+	c.in.Close()
+
+	select {
+	case <-c.rpc.done:
+	case <-ctx.Done():
+		if c.cmd != nil && c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+			<-c.rpc.done
+		} else {
+			c.rpc.fail(errRPCClosed)
+		}
+	}
+	return nil
+}
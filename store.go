@@ -0,0 +1,450 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内存中的对象存储, 实现数据 API 的基本读写及查询, 用于本地测试云代码
+type MemoryStore struct {
+
+	// 生成 createdAt 及 updatedAt 的时钟, 为 nil 时使用系统时钟
+	Clock Clock
+
+	mu      sync.RWMutex
+	classes map[string]map[string]map[string]interface{}
+	seq     int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{classes: make(map[string]map[string]map[string]interface{})}
+}
+
+// 读取对象, 返回副本
+func (s *MemoryStore) Get(className, objectId string) (map[string]interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, ok := s.classes[className][objectId]
+	if !ok {
+		return nil, notFound(className, objectId)
+	}
+	return copyObject(obj), nil
+}
+
+// 创建对象, data 中的原子操作按空对象计算.
+// data 中可以指定 objectId, 对象已存在时返回 ErrCodeDuplicate 错误, 不会覆盖
+func (s *MemoryStore) Create(className string, data map[string]interface{}) (map[string]interface{}, error) {
+	obj, err := ApplyData(nil, DecodeData(data))
+	if err != nil {
+		return nil, CloudError{Code: ErrCodeInvalidJSON, Message: err.Error()}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	objectId, _ := obj["objectId"].(string)
+	if _, ok := s.classes[className][objectId]; ok && objectId != "" {
+		return nil, CloudError{Code: ErrCodeDuplicate, Message: fmt.Sprintf("%s 对象已存在: %s", className, objectId)}
+	}
+	// 生成的 Id 可能与指定的 Id 重复, 跳过已存在的
+	for objectId == "" || s.classes[className][objectId] != nil {
+		s.seq++
+		objectId = fmt.Sprintf("%016x", s.seq)
+	}
+	now := NewDate(clockOrSystem(s.Clock).Now())
+	obj["objectId"] = objectId
+	obj["createdAt"] = now
+	obj["updatedAt"] = now
+
+	if s.classes[className] == nil {
+		s.classes[className] = make(map[string]map[string]interface{})
+	}
+	s.classes[className][objectId] = obj
+	return copyObject(obj), nil
+}
+
+// 更新对象, 支持原子操作
+func (s *MemoryStore) Update(className, objectId string, data map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.classes[className][objectId]
+	if !ok {
+		return nil, notFound(className, objectId)
+	}
+	obj, err := ApplyData(prev, DecodeData(data))
+	if err != nil {
+		return nil, CloudError{Code: ErrCodeInvalidJSON, Message: err.Error()}
+	}
+	obj["objectId"] = objectId
+	obj["createdAt"] = prev["createdAt"]
+	obj["updatedAt"] = NewDate(clockOrSystem(s.Clock).Now())
+	s.classes[className][objectId] = obj
+	return copyObject(obj), nil
+}
+
+// 删除对象
+func (s *MemoryStore) Delete(className, objectId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.classes[className][objectId]; !ok {
+		return notFound(className, objectId)
+	}
+	delete(s.classes[className], objectId)
+	return nil
+}
+
+// 按查询条件返回对象
+func (s *MemoryStore) Find(q *Query) (*QueryResult, error) {
+	return s.FindFor(CloudSession{Master: true}, q)
+}
+
+// 按查询条件返回 session 有读权限的对象
+func (s *MemoryStore) FindFor(session CloudSession, q *Query) (*QueryResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var results []map[string]interface{}
+	for _, obj := range s.classes[q.ClassName] {
+		if acl, err := ObjectACL(obj); err != nil || !acl.CanRead(session) {
+			continue
+		}
+		ok, err := matchWhere(obj, q.Where)
+		if err != nil {
+			return nil, CloudError{Code: ErrCodeInvalidQuery, Message: err.Error()}
+		}
+		if ok {
+			results = append(results, obj)
+		}
+	}
+	sortObjects(results, q)
+
+	count := len(results)
+	if q.Skip > 0 {
+		if q.Skip >= len(results) {
+			results = nil
+		} else {
+			results = results[q.Skip:]
+		}
+	}
+	if q.Limit > 0 && q.Limit < len(results) {
+		results = results[:q.Limit]
+	}
+
+	res := &QueryResult{Count: count, Results: make([]map[string]interface{}, len(results))}
+	for i, obj := range results {
+		obj = copyObject(obj)
+		s.include(obj, q.Include)
+		res.Results[i] = selectKeys(obj, q.Keys)
+	}
+	return res, nil
+}
+
+// 以 DataAPI 接口访问存储, 使用 Master 权限; 用于在测试中代替 DataClient
+func (s *MemoryStore) DataAPI() DataAPI {
+	return memoryDataAPI{s}
+}
+
+type memoryDataAPI struct {
+	store *MemoryStore
+}
+
+func (m memoryDataAPI) Find(ctx context.Context, q *Query) (*QueryResult, error) {
+	return m.store.Find(q)
+}
+
+func (m memoryDataAPI) Save(ctx context.Context, className, objectId string, data map[string]interface{}) (string, error) {
+	if objectId == "" {
+		obj, err := m.store.Create(className, data)
+		if err != nil {
+			return "", err
+		}
+		return obj["objectId"].(string), nil
+	}
+	_, err := m.store.Update(className, objectId, data)
+	return objectId, err
+}
+
+func (m memoryDataAPI) Delete(ctx context.Context, className, objectId string) error {
+	return m.store.Delete(className, objectId)
+}
+
+// 将 Pointer 字段替换为指向的对象, 只支持第一层字段
+func (s *MemoryStore) include(obj map[string]interface{}, keys []string) {
+	for _, key := range keys {
+		key = strings.SplitN(key, ".", 2)[0]
+		p, ok := obj[key].(Pointer)
+		if !ok {
+			continue
+		}
+		if target, ok := s.classes[p.ClassName][p.ObjectId]; ok {
+			included := copyObject(target)
+			included["className"] = p.ClassName
+			obj[key] = included
+		}
+	}
+}
+
+func notFound(className, objectId string) error {
+	return CloudError{Code: ErrCodeNotFound, Message: fmt.Sprintf("%s 对象不存在: %s", className, objectId)}
+}
+
+func copyObject(obj map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(obj))
+	for k, v := range obj {
+		c[k] = v
+	}
+	return c
+}
+
+func selectKeys(obj map[string]interface{}, keys []string) map[string]interface{} {
+	if len(keys) == 0 {
+		return obj
+	}
+	result := map[string]interface{}{
+		"objectId":  obj["objectId"],
+		"createdAt": obj["createdAt"],
+		"updatedAt": obj["updatedAt"],
+	}
+	for _, key := range keys {
+		if v, ok := obj[key]; ok {
+			result[key] = v
+		}
+	}
+	return result
+}
+
+// 判断对象是否符合查询条件
+func matchWhere(obj, where map[string]interface{}) (bool, error) {
+	for key, cond := range where {
+		// 查询参数中的特殊类型可能是指针(如 NewPointer), 与对象中的值统一
+		cond = DecodeField(cond)
+		value, exists := obj[key]
+		m, isCond := cond.(map[string]interface{})
+		if !isCond || !isConditionMap(m) {
+			if !matchEqual(value, cond) {
+				return false, nil
+			}
+			continue
+		}
+		for op, arg := range m {
+			ok, err := matchCondition(op, value, exists, arg, m)
+			if err != nil {
+				return false, fmt.Errorf("字段 %s: %v", key, err)
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func isConditionMap(m map[string]interface{}) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCondition(op string, value interface{}, exists bool, arg interface{}, cond map[string]interface{}) (bool, error) {
+	switch op {
+	case QueryOpNotEqual:
+		return !matchEqual(value, arg), nil
+	case QueryOpLessThan, QueryOpLessOrEqual, QueryOpGreaterThan, QueryOpGreaterOrEqual:
+		c, ok := compareValues(value, arg)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case QueryOpLessThan:
+			return c < 0, nil
+		case QueryOpLessOrEqual:
+			return c <= 0, nil
+		case QueryOpGreaterThan:
+			return c > 0, nil
+		default:
+			return c >= 0, nil
+		}
+	case QueryOpIn, QueryOpNotIn:
+		list, ok := arg.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("%s 的参数必须是数组", op)
+		}
+		in := false
+		for _, item := range list {
+			if matchEqual(value, item) {
+				in = true
+				break
+			}
+		}
+		return in == (op == QueryOpIn), nil
+	case QueryOpExists:
+		want, _ := arg.(bool)
+		return exists == want, nil
+	case QueryOpRegex:
+		pattern, _ := arg.(string)
+		if options, _ := cond[QueryOpRegexOptions].(string); strings.Contains(options, "i") {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		s, ok := value.(string)
+		return ok && re.MatchString(s), nil
+	case QueryOpRegexOptions:
+		return true, nil
+	case QueryOpNear:
+		point, ok := toGeoPoint(value)
+		if !ok {
+			return false, nil
+		}
+		center, ok := toGeoPoint(arg)
+		if !ok {
+			return false, fmt.Errorf("%s 的参数必须是 GeoPoint", op)
+		}
+		if max, ok := toFloat(cond[QueryOpMaxDistance]); ok && max > 0 {
+			return point.KilometersTo(center) <= max, nil
+		}
+		return true, nil
+	case QueryOpMaxDistance:
+		return true, nil
+	}
+	return false, fmt.Errorf("不支持的查询条件: %s", op)
+}
+
+// 等值比较, 数组字段包含该值时也视为相等
+func matchEqual(value, arg interface{}) bool {
+	if list, ok := value.([]interface{}); ok {
+		if _, argIsList := arg.([]interface{}); !argIsList {
+			return indexOf(list, arg) >= 0
+		}
+	}
+	if c, ok := compareValues(value, arg); ok {
+		return c == 0
+	}
+	return valuesEqual(value, arg)
+}
+
+// 比较数值, 字符串及日期, ok 为 false 表示两者不可比较
+func compareValues(a, b interface{}) (c int, ok bool) {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, true
+		}
+		return 0, false
+	}
+	if x, ok := a.(string); ok {
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+		return 0, false
+	}
+	if x, err := ParseDate(a); err == nil && isDateValue(a) {
+		if y, err := ParseDate(b); err == nil && isDateValue(b) {
+			switch {
+			case x.Before(y.Time):
+				return -1, true
+			case x.After(y.Time):
+				return 1, true
+			}
+			return 0, true
+		}
+	}
+	return 0, false
+}
+
+func isDateValue(v interface{}) bool {
+	switch t := v.(type) {
+	case Date, *Date, time.Time:
+		return true
+	case map[string]interface{}:
+		return t["__type"] == TypeDate
+	}
+	return false
+}
+
+func toGeoPoint(v interface{}) (GeoPoint, bool) {
+	switch t := v.(type) {
+	case GeoPoint:
+		return t, true
+	case *GeoPoint:
+		return *t, true
+	}
+	return GeoPoint{}, false
+}
+
+// 两点之间的距离(公里)
+func (g GeoPoint) KilometersTo(other GeoPoint) float64 {
+	const earthRadius = 6371.0
+	rad := math.Pi / 180
+	lat1, lat2 := g.Latitude*rad, other.Latitude*rad
+	dLat := lat2 - lat1
+	dLng := (other.Longitude - g.Longitude) * rad
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadius * math.Asin(math.Sqrt(h))
+}
+
+// 按查询的 order 排序; 有 $nearSphere 条件且未指定排序时按距离排序; 都没有时按 objectId 排序以保证结果稳定
+func sortObjects(objects []map[string]interface{}, q *Query) {
+	var nearKey string
+	var center GeoPoint
+	for key, cond := range q.Where {
+		if m, ok := cond.(map[string]interface{}); ok {
+			if p, ok := toGeoPoint(m[QueryOpNear]); ok {
+				nearKey, center = key, p
+			}
+		}
+	}
+
+	sort.SliceStable(objects, func(i, j int) bool {
+		for _, order := range q.Order {
+			key, desc := order, false
+			if strings.HasPrefix(order, "-") {
+				key, desc = order[1:], true
+			}
+			c, ok := compareValues(objects[i][key], objects[j][key])
+			if !ok || c == 0 {
+				continue
+			}
+			return (c < 0) != desc
+		}
+		if nearKey != "" && len(q.Order) == 0 {
+			a, aok := toGeoPoint(objects[i][nearKey])
+			b, bok := toGeoPoint(objects[j][nearKey])
+			if aok && bok {
+				return a.KilometersTo(center) < b.KilometersTo(center)
+			}
+		}
+		return objectIdLess(objects[i], objects[j])
+	})
+}
+
+func objectIdLess(a, b map[string]interface{}) bool {
+	x, _ := a["objectId"].(string)
+	y, _ := b["objectId"].(string)
+	if nx, err := strconv.ParseUint(x, 16, 64); err == nil {
+		if ny, err := strconv.ParseUint(y, 16, 64); err == nil {
+			return nx < ny
+		}
+	}
+	return x < y
+}
@@ -0,0 +1,251 @@
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// 流式结果的格式
+type StreamFormat string
+
+const (
+	// 每行一个 JSON: {"item": ...}, 最后一行为 {"trailer": ...}
+	StreamNDJSON StreamFormat = "application/x-ndjson"
+
+	// Server-Sent Events: 每条结果为一个 item 事件, 最后为 trailer 事件
+	StreamSSE StreamFormat = "text/event-stream"
+)
+
+// 流式结果的写入方, 每次写入一条结果
+type ResultWriter interface {
+	Write(item interface{}) error
+}
+
+// 流式云函数, 用于导出等结果很大的场景: 通过 w 逐条输出结果, 不必在内存中构造完整的 Result.
+// 返回值的 Errors 和 Logs 在所有结果之后作为结尾发送, Result 和 Data 被忽略; 返回 nil 视为成功.
+// w.Write 返回错误(如客户端已断开)时应停止输出并返回.
+type StreamFunc func(ctx context.Context, req *CloudRequest, w ResultWriter) *CloudeResponse
+
+// 支持流式调用云函数的 Handler, Registry 和 Router 实现了此接口
+type StreamHandler interface {
+	Handler
+
+	// 调用云函数并逐条写入结果, 返回的 CloudeResponse 只有 Successed, Errors 和 Logs
+	Stream(ctx context.Context, name string, req *CloudRequest, w ResultWriter) *CloudeResponse
+}
+
+// 流式结果的结尾
+type StreamTrailer struct {
+
+	// 是否成功, 为 false 时已发送的结果可能不完整
+	Successed bool `json:"successed"`
+
+	// 已发送的结果条数
+	Count int `json:"count"`
+
+	Errors CloudError `json:"error"`
+	Logs   []CloudLog `json:"logs"`
+}
+
+// 调用流式云函数, 捕获 panic, 返回 nil 时视为成功
+func invokeStream(ctx context.Context, fn StreamFunc, req *CloudRequest, w ResultWriter) (res *CloudeResponse) {
+	defer func() {
+		if err := recover(); err != nil {
+			res = Fail(ErrCodeCloudFailure, fmt.Sprintf("云代码执行出错: %v", err))
+		}
+	}()
+	res = fn(ctx, req, w)
+	if res == nil {
+		res = &CloudeResponse{Successed: true}
+	}
+	return
+}
+
+// 将结果收集为数组放入 Result, 用于不支持流式的调用方式.
+// NOTE: 会在内存中保存全部结果
+type collectWriter struct {
+	items []interface{}
+}
+
+func (c *collectWriter) Write(item interface{}) error {
+	c.items = append(c.items, item)
+	return nil
+}
+
+// 按数组逐条写入普通云函数的 Result, Result 不是数组时作为一条结果写入
+func writeResult(w ResultWriter, result interface{}) error {
+	if result == nil {
+		return nil
+	}
+	v := reflect.ValueOf(result)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return w.Write(result)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := w.Write(v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 将结果编码到 io.Writer
+type streamEncoder struct {
+	w       io.Writer
+	format  StreamFormat
+	flusher http.Flusher
+	count   int
+}
+
+func newStreamEncoder(w io.Writer, format StreamFormat) *streamEncoder {
+	e := &streamEncoder{w: w, format: format}
+	e.flusher, _ = w.(http.Flusher)
+	return e
+}
+
+func (e *streamEncoder) Write(item interface{}) error {
+	b, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	if err := e.event("item", b); err != nil {
+		return err
+	}
+	e.count++
+	return nil
+}
+
+func (e *streamEncoder) trailer(res *CloudeResponse) error {
+	b, err := json.Marshal(StreamTrailer{
+		Successed: res.Successed,
+		Count:     e.count,
+		Errors:    res.Errors,
+		Logs:      res.Logs,
+	})
+	if err != nil {
+		return err
+	}
+	return e.event("trailer", b)
+}
+
+func (e *streamEncoder) event(name string, data []byte) error {
+	var err error
+	if e.format == StreamSSE {
+		_, err = fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", name, data)
+	} else {
+		_, err = fmt.Fprintf(e.w, "{%q:%s}\n", name, data)
+	}
+	// 每条结果都需要尽快送达客户端
+	if err == nil && e.flusher != nil {
+		e.flusher.Flush()
+	}
+	return err
+}
+
+// 将流式调用的结果写到 w, 最后写入结尾
+func WriteStream(ctx context.Context, w io.Writer, format StreamFormat, h StreamHandler, name string, req *CloudRequest) error {
+	e := newStreamEncoder(w, format)
+	return e.trailer(h.Stream(ctx, name, req, e))
+}
+
+// 读取流式结果, 每条结果调用一次 fn, 返回结尾.
+// fn 返回错误时停止读取并返回该错误; 流在结尾之前中断时返回错误.
+func ReadStream(r io.Reader, format StreamFormat, fn func(item json.RawMessage) error) (*StreamTrailer, error) {
+	br := bufio.NewReader(r)
+	var (
+		event string
+		data  []byte
+	)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			if err == io.EOF {
+				return nil, errors.New("结果流在结尾之前中断")
+			}
+			return nil, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+
+		if format == StreamSSE {
+			switch {
+			case len(line) == 0:
+				if event == "" && data == nil {
+					continue
+				}
+			case bytes.HasPrefix(line, []byte("event:")):
+				event = strings.TrimSpace(string(line[6:]))
+				continue
+			case bytes.HasPrefix(line, []byte("data:")):
+				// 多行 data 以换行连接
+				if data != nil {
+					data = append(data, '\n')
+				}
+				data = append(data, bytes.TrimPrefix(line[5:], []byte(" "))...)
+				if data == nil {
+					data = []byte{}
+				}
+				continue
+			default:
+				continue
+			}
+		} else {
+			if len(line) == 0 {
+				continue
+			}
+			var msg struct {
+				Item    json.RawMessage `json:"item"`
+				Trailer json.RawMessage `json:"trailer"`
+			}
+			if err := json.Unmarshal(line, &msg); err != nil {
+				return nil, err
+			}
+			event, data = "item", msg.Item
+			if msg.Trailer != nil {
+				event, data = "trailer", msg.Trailer
+			}
+		}
+
+		switch event {
+		case "trailer":
+			var t StreamTrailer
+			if err := json.Unmarshal(data, &t); err != nil {
+				return nil, err
+			}
+			return &t, nil
+		case "item":
+			if err := fn(json.RawMessage(data)); err != nil {
+				return nil, err
+			}
+		}
+		event, data = "", nil
+	}
+}
+
+// 根据 Accept 请求头选择流式格式, 不需要流式时返回 ""
+func acceptStream(r *http.Request) StreamFormat {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, string(StreamNDJSON)):
+		return StreamNDJSON
+	case strings.Contains(accept, string(StreamSSE)):
+		return StreamSSE
+	}
+	return ""
+}
+
+func serveHTTPStream(w http.ResponseWriter, r *http.Request, h StreamHandler, name string, req *CloudRequest, format StreamFormat) {
+	w.Header().Set("Content-Type", string(format)+"; charset=utf-8")
+	if format == StreamSSE {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.WriteHeader(http.StatusOK)
+	WriteStream(r.Context(), w, format, h, name, req)
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// 调用目标: 云函数或表上的钩子.
+// 各种传输方式使用同一路径格式:
+//
+//	functions/{name}
+//	hooks/{className}/{hook}
+type Target struct {
+	Function  string
+	ClassName string
+	Hook      HookType
+}
+
+func FunctionTarget(name string) Target {
+	return Target{Function: name}
+}
+
+func HookTarget(className string, hook HookType) Target {
+	return Target{ClassName: className, Hook: hook}
+}
+
+// 解析调用路径, 前后的 "/" 会被忽略
+func ParseTarget(path string) (Target, error) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "functions" && parts[1] != "":
+		return FunctionTarget(parts[1]), nil
+	case len(parts) == 3 && parts[0] == "hooks" && parts[1] != "" && parts[2] != "":
+		return HookTarget(parts[1], HookType(parts[2])), nil
+	}
+	return Target{}, fmt.Errorf("无效的调用路径: %q", path)
+}
+
+func (t Target) Path() string {
+	if t.Function != "" {
+		return "functions/" + t.Function
+	}
+	return "hooks/" + t.ClassName + "/" + string(t.Hook)
+}
+
+// 按调用目标分发到 Handler
+func Dispatch(ctx context.Context, h Handler, t Target, req *CloudRequest) *CloudeResponse {
+	if t.Function != "" {
+		return h.Call(ctx, t.Function, req)
+	}
+	return h.RunHook(ctx, t.ClassName, t.Hook, req)
+}
@@ -0,0 +1,170 @@
+// 本地测试云代码用的工具, 与 types 包分开, 避免使用 types 的程序引入 net/http/httptest
+package typestest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	types "github.com/skynology/cloud-types"
+)
+
+// 本地数据 API 桩服务器, 对象保存在 types.MemoryStore 中.
+// 用于在没有真实后端时测试使用 types.DataClient 的云代码:
+//
+//	stub := typestest.NewStubServer(types.NewMemoryStore())
+//	defer stub.Close()
+//	client := stub.Client(req.Session)
+type StubServer struct {
+
+	// 服务器地址, 可直接作为 types.DataClient.BaseURL
+	URL string
+
+	// Master Key, 请求头中的 Master Key 与此不一致时返回 119 错误
+	MasterKey string
+
+	Store *types.MemoryStore
+
+	server *httptest.Server
+}
+
+// 启动桩服务器, 监听本地随机端口
+func NewStubServer(store *types.MemoryStore) *StubServer {
+	s := &StubServer{MasterKey: "stub-master-key", Store: store}
+	s.server = httptest.NewServer(s)
+	s.URL = s.server.URL
+	return s
+}
+
+// 创建访问桩服务器的客户端
+func (s *StubServer) Client(session types.CloudSession) *types.DataClient {
+	c := types.NewDataClient(s.URL, s.MasterKey, session)
+	c.HTTPClient = s.server.Client()
+	return c
+}
+
+func (s *StubServer) Close() {
+	s.server.Close()
+}
+
+func (s *StubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get(types.HeaderMasterKey) != s.MasterKey {
+		writeStubError(w, http.StatusUnauthorized, types.CloudError{Code: types.ErrCodeForbidden, Message: "Master Key 错误"})
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "classes" {
+		writeStubError(w, http.StatusNotFound, types.CloudError{Code: types.ErrCodeNotFound, Message: "不支持的路径: " + r.URL.Path})
+		return
+	}
+	var session types.CloudSession
+	if h := r.Header.Get(types.HeaderCloudSession); h != "" {
+		if err := json.Unmarshal([]byte(h), &session); err != nil {
+			writeStubError(w, http.StatusBadRequest, types.CloudError{Code: types.ErrCodeInvalidJSON, Message: "Session 格式错误"})
+			return
+		}
+	}
+	className, _ := url.PathUnescape(parts[1])
+	var objectId string
+	if len(parts) == 3 {
+		objectId, _ = url.PathUnescape(parts[2])
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch {
+	case r.Method == "GET" && objectId != "":
+		result, err = s.checkACL(session, className, objectId, false)
+	case r.Method == "GET":
+		var q *types.Query
+		if q, err = types.ParseQuery(className, r.URL.Query()); err == nil {
+			result, err = s.Store.FindFor(session, q)
+		} else {
+			err = types.CloudError{Code: types.ErrCodeInvalidQuery, Message: err.Error()}
+		}
+	case r.Method == "POST" && objectId == "":
+		var data map[string]interface{}
+		if data, err = decodeStubBody(r); err == nil {
+			var obj map[string]interface{}
+			if obj, err = s.Store.Create(className, data); err == nil {
+				result = map[string]interface{}{"objectId": obj["objectId"], "createdAt": obj["createdAt"]}
+			}
+		}
+	case r.Method == "PUT" && objectId != "":
+		var data map[string]interface{}
+		if data, err = decodeStubBody(r); err == nil {
+			var obj map[string]interface{}
+			if _, err = s.checkACL(session, className, objectId, true); err != nil {
+				break
+			}
+			if obj, err = s.Store.Update(className, objectId, data); err == nil {
+				result = map[string]interface{}{"updatedAt": obj["updatedAt"]}
+			}
+		}
+	case r.Method == "DELETE" && objectId != "":
+		if _, err = s.checkACL(session, className, objectId, true); err == nil {
+			err = s.Store.Delete(className, objectId)
+			result = map[string]interface{}{}
+		}
+	default:
+		writeStubError(w, http.StatusMethodNotAllowed, types.CloudError{Code: types.ErrCodeInvalidQuery, Message: "不支持的操作: " + r.Method})
+		return
+	}
+
+	if err != nil {
+		status := http.StatusBadRequest
+		if cerr, ok := err.(types.CloudError); ok {
+			switch cerr.Code {
+			case types.ErrCodeNotFound:
+				status = http.StatusNotFound
+			case types.ErrCodeForbidden:
+				status = http.StatusForbidden
+			case types.ErrCodeDuplicate:
+				status = http.StatusConflict
+			}
+		}
+		writeStubError(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// 读取对象并按对象的 ACL 检查 session 的权限
+func (s *StubServer) checkACL(session types.CloudSession, className, objectId string, write bool) (map[string]interface{}, error) {
+	obj, err := s.Store.Get(className, objectId)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := types.ObjectACL(obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := acl.Check(session, write); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func decodeStubBody(r *http.Request) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		return nil, types.CloudError{Code: types.ErrCodeInvalidJSON, Message: err.Error()}
+	}
+	return data, nil
+}
+
+func writeStubError(w http.ResponseWriter, status int, err error) {
+	cerr, ok := err.(types.CloudError)
+	if !ok {
+		cerr = types.CloudError{Code: types.ErrCodeInternal, Message: err.Error()}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(cerr)
+}
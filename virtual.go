@@ -0,0 +1,110 @@
+package types
+
+import (
+	"context"
+	"fmt"
+)
+
+// 虚拟字段的计算函数, obj 为对象(不要修改), 返回字段的值
+type VirtualField func(ctx context.Context, obj map[string]interface{}, session CloudSession) (interface{}, error)
+
+type virtualField struct {
+	name string
+	fn   VirtualField
+}
+
+// 为表声明虚拟字段, 同名字段会被覆盖:
+//
+//	registry.Virtual("User", "displayName", func(ctx context.Context, obj map[string]interface{}, session types.CloudSession) (interface{}, error) {
+//		return fmt.Sprint(obj["lastName"], obj["firstName"]), nil
+//	})
+//
+// 虚拟字段不会保存: 查询结果在 afterFind 钩子执行前计算并加入对象;
+// beforeSave 的返回中自动加入 Protect, 客户端不能写入: 调用参数 Data 中的同名字段在处理函数执行前去掉,
+// 处理函数返回的 Data 中的同名字段也会被去掉.
+func (r *Registry) Virtual(className, field string, fn VirtualField) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fields := r.virtuals[className]
+	for i, f := range fields {
+		if f.name == field {
+			fields[i].fn = fn
+			return
+		}
+	}
+	r.virtuals[className] = append(fields, virtualField{name: field, fn: fn})
+}
+
+// 表的虚拟字段名, 按声明顺序
+func (r *Registry) VirtualFields(className string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.virtuals[className]))
+	for _, f := range r.virtuals[className] {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// 计算虚拟字段, 返回加入了虚拟字段的对象副本.
+// 计算出错的字段不加入对象, 错误记录在返回的 logs 中
+func (r *Registry) ComputeVirtual(ctx context.Context, className string, session CloudSession, obj map[string]interface{}) (result map[string]interface{}, logs []CloudLog) {
+	r.mu.RLock()
+	fields := append([]virtualField(nil), r.virtuals[className]...)
+	r.mu.RUnlock()
+	if len(fields) == 0 || obj == nil {
+		return obj, nil
+	}
+
+	result = copyObject(obj)
+	for _, f := range fields {
+		v, err := computeVirtual(ctx, f.fn, obj, session)
+		if err != nil {
+			logs = append(logs, NewLog(ctx, "virtual", fmt.Sprintf("虚拟字段 %s.%s 计算失败: %v", className, f.name, err)))
+			continue
+		}
+		result[f.name] = v
+	}
+	return result, logs
+}
+
+func computeVirtual(ctx context.Context, fn VirtualField, obj map[string]interface{}, session CloudSession) (v interface{}, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("%v", e)
+		}
+	}()
+	return fn(ctx, obj, session)
+}
+
+// beforeSave 的调用参数: 返回 Data 中去掉虚拟字段的副本, 没有虚拟字段时返回 req 本身
+func (r *Registry) withoutVirtual(className string, req *CloudRequest) *CloudRequest {
+	var copied *CloudRequest
+	for _, name := range r.VirtualFields(className) {
+		if _, ok := req.Data[name]; !ok {
+			continue
+		}
+		if copied == nil {
+			c := *req
+			c.Data = copyObject(req.Data)
+			copied = &c
+		}
+		delete(copied.Data, name)
+	}
+	if copied == nil {
+		return req
+	}
+	return copied
+}
+
+// beforeSave 的返回: 虚拟字段加入 Protect, 并从 Data 中去掉
+func (r *Registry) protectVirtual(className string, res *CloudeResponse) {
+	names := r.VirtualFields(className)
+	if len(names) == 0 || !res.Successed {
+		return
+	}
+	res.Protect = unionStrings(res.Protect, names)
+	for _, name := range names {
+		delete(res.Data, name)
+	}
+}
@@ -0,0 +1,116 @@
+// 将微信推送的消息适配为云函数, 与 wechat 包分开, 避免只使用消息类型的程序引入 types 包
+package adapter
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"strings"
+
+	types "github.com/skynology/cloud-types"
+)
+
+// 没有被动回复时返回给微信服务器的内容
+const ReplySuccess = "success"
+
+// 处理函数, 返回的 reply 为被动回复的消息, 如 *mp.ResText; 为 nil 时不回复
+type handlerFunc func(ctx context.Context, req *types.CloudRequest, data string) (reply interface{}, err error)
+
+// 绑定具体消息类型的处理函数: 先用 decode 解析 ExtraData, 再调用 h
+func bind[T any](decode func(string) (*T, error), h func(context.Context, *types.CloudRequest, *T) (interface{}, error)) handlerFunc {
+	return func(ctx context.Context, req *types.CloudRequest, data string) (interface{}, error) {
+		msg, err := decode(data)
+		if err != nil {
+			return nil, err
+		}
+		return h(ctx, req, msg)
+	}
+}
+
+// 用于判断消息类型的消息头
+type messageHead struct {
+	XMLName  struct{} `xml:"xml"`
+	MsgType  string   `xml:"MsgType"`
+	Event    string   `xml:"Event"`
+	EventKey string   `xml:"EventKey"`
+}
+
+// 公众号及企业号适配器共用的分发逻辑
+type adapter struct {
+
+	// 没有被动回复时写入 CloudeResponse.ExtraData 的内容, 默认为 "success"
+	EmptyReply string
+
+	// 处理函数中 ctx 的时钟, 用于回复的 CreateTime(见 NewMPReply); 为 nil 时沿用调用方 ctx 中的时钟
+	Clock types.Clock
+
+	handlers map[string]handlerFunc
+	fallback handlerFunc
+}
+
+func newAdapter() adapter {
+	return adapter{EmptyReply: ReplySuccess, handlers: make(map[string]handlerFunc)}
+}
+
+func messageKey(msgType string) string { return "msg:" + msgType }
+func eventKey(event string) string     { return "event:" + event }
+
+// 解析 CloudRequest.ExtraData, 调用对应的处理函数, 并将回复编码为 XML 写入 CloudeResponse.ExtraData.
+// 可直接作为 types.CloudFunc 注册
+func (a *adapter) serve(ctx context.Context, req *types.CloudRequest, route func(messageHead) string) *types.CloudeResponse {
+	data := strings.TrimSpace(req.ExtraData)
+	if data == "" {
+		return types.Fail(types.ErrCodeInvalidJSON, "ExtraData 为空, 不是微信推送的消息")
+	}
+	var head messageHead
+	if err := xml.Unmarshal([]byte(data), &head); err != nil {
+		return types.Fail(types.ErrCodeInvalidJSON, "ExtraData 不是有效的 XML: "+err.Error())
+	}
+
+	if a.Clock != nil {
+		ctx = types.WithClock(ctx, a.Clock)
+	}
+	h, ok := a.handlers[route(head)]
+	if !ok {
+		h = a.fallback
+	}
+	var reply interface{}
+	if h != nil {
+		var err error
+		if reply, err = h(ctx, req, data); err != nil {
+			return types.Fail(types.ErrCodeCloudFailure, err.Error())
+		}
+	}
+
+	res := &types.CloudeResponse{Successed: true, ExtraData: a.EmptyReply}
+	if reply != nil {
+		b, err := MarshalReply(reply)
+		if err != nil {
+			return types.Fail(types.ErrCodeCloudFailure, err.Error())
+		}
+		res.ExtraData = b
+	}
+	return res
+}
+
+// 将被动回复编码为 XML, reply 为字符串时原样返回
+func MarshalReply(reply interface{}) (string, error) {
+	switch t := reply.(type) {
+	case string:
+		return t, nil
+	case []byte:
+		return string(t), nil
+	}
+	if checker, ok := reply.(interface {
+		CheckValid() error
+	}); ok {
+		if err := checker.CheckValid(); err != nil {
+			return "", err
+		}
+	}
+	b, err := xml.Marshal(reply)
+	if err != nil {
+		return "", errors.New("被动回复编码失败: " + err.Error())
+	}
+	return string(b), nil
+}
@@ -0,0 +1,134 @@
+package adapter
+
+import (
+	"context"
+
+	types "github.com/skynology/cloud-types"
+	"github.com/skynology/cloud-types/wechat/corp"
+)
+
+// 企业号消息适配器.
+// 将 CloudRequest.ExtraData 中微信推送的 XML 解析为 corp 包中对应的类型并调用处理函数,
+// 处理函数返回的 Res* 回复编码后写入 CloudeResponse.ExtraData:
+//
+//	a := adapter.NewCorpAdapter()
+//	a.OnText(func(ctx context.Context, req *types.CloudRequest, msg *corp.ReqText) (interface{}, error) {
+//		return adapter.NewCorpReply(ctx, &msg.CommonMessageHeader).Text(msg.Content), nil
+//	})
+//	registry.Define("wechat", a.Serve)
+type CorpAdapter struct {
+	adapter
+}
+
+func NewCorpAdapter() *CorpAdapter {
+	return &CorpAdapter{adapter: newAdapter()}
+}
+
+// 处理云函数调用, 签名与 types.CloudFunc 一致
+func (a *CorpAdapter) Serve(ctx context.Context, req *types.CloudRequest) *types.CloudeResponse {
+	return a.serve(ctx, req, corpRoute)
+}
+
+// 没有对应处理函数的消息及事件, header 为消息头
+func (a *CorpAdapter) OnDefault(h func(ctx context.Context, req *types.CloudRequest, header *corp.CommonMessageHeader) (interface{}, error)) {
+	a.fallback = bind(func(data string) (*corp.CommonMessageHeader, error) {
+		var header struct {
+			XMLName struct{} `xml:"xml"`
+			corp.CommonMessageHeader
+		}
+		err := corp.UnmarshalXML([]byte(data), &header)
+		return &header.CommonMessageHeader, err
+	}, h)
+}
+
+// 文本消息
+func (a *CorpAdapter) OnText(h func(ctx context.Context, req *types.CloudRequest, msg *corp.ReqText) (interface{}, error)) {
+	a.handlers[messageKey(corp.MsgTypeText)] = bind(corp.GetText, h)
+}
+
+// 图片消息
+func (a *CorpAdapter) OnImage(h func(ctx context.Context, req *types.CloudRequest, msg *corp.ReqImage) (interface{}, error)) {
+	a.handlers[messageKey(corp.MsgTypeImage)] = bind(corp.GetImage, h)
+}
+
+// 语音消息
+func (a *CorpAdapter) OnVoice(h func(ctx context.Context, req *types.CloudRequest, msg *corp.ReqVoice) (interface{}, error)) {
+	a.handlers[messageKey(corp.MsgTypeVoice)] = bind(corp.GetVoice, h)
+}
+
+// 视频消息
+func (a *CorpAdapter) OnVideo(h func(ctx context.Context, req *types.CloudRequest, msg *corp.ReqVideo) (interface{}, error)) {
+	a.handlers[messageKey(corp.MsgTypeVideo)] = bind(corp.GetVideo, h)
+}
+
+// 地理位置消息
+func (a *CorpAdapter) OnLocation(h func(ctx context.Context, req *types.CloudRequest, msg *corp.ReqLocation) (interface{}, error)) {
+	a.handlers[messageKey(corp.MsgTypeLocation)] = bind(corp.GetLocation, h)
+}
+
+// 关注事件
+func (a *CorpAdapter) OnSubscribe(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqSubscribeEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeSubscribe)] = bind(corp.GetSubscribeEvent, h)
+}
+
+// 取消关注
+func (a *CorpAdapter) OnUnsubscribe(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqUnsubscribeEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeUnsubscribe)] = bind(corp.GetUnsubscribeEvent, h)
+}
+
+// 上报地理位置事件
+func (a *CorpAdapter) OnLocationEvent(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqLocationEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeLocation)] = bind(corp.GetLocationEvent, h)
+}
+
+// 点击菜单拉取消息
+func (a *CorpAdapter) OnClick(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqClickEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeClick)] = bind(corp.GetClickEvent, h)
+}
+
+// 点击菜单跳转链接
+func (a *CorpAdapter) OnView(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqViewEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeView)] = bind(corp.GetViewEvent, h)
+}
+
+// 扫码推事件
+func (a *CorpAdapter) OnScanCodePush(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqScanCodePushEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeScanCodePush)] = bind(corp.GetScanCodePushEvent, h)
+}
+
+// 扫码推事件且弹出“消息接收中”提示框
+func (a *CorpAdapter) OnScanCodeWaitMsg(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqScanCodeWaitMsgEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeScanCodeWaitMsg)] = bind(corp.GetScanCodeWaitMsgEvent, h)
+}
+
+// 弹出系统拍照发图
+func (a *CorpAdapter) OnPicSysPhoto(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqPicSysPhotoEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypePicSysPhoto)] = bind(corp.GetPicSysPhotoEvent, h)
+}
+
+// 弹出拍照或者相册发图
+func (a *CorpAdapter) OnPicPhotoOrAlbum(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqPicPhotoOrAlbumEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypePicPhotoOrAlbum)] = bind(corp.GetPicPhotoOrAlbumEvent, h)
+}
+
+// 弹出微信相册发图器
+func (a *CorpAdapter) OnPicWeixin(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqPicWeixinEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypePicWeixin)] = bind(corp.GetPicWeixinEvent, h)
+}
+
+// 弹出地理位置选择器
+func (a *CorpAdapter) OnLocationSelect(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqLocationSelectEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeLocationSelect)] = bind(corp.GetLocationSelectEvent, h)
+}
+
+// 用户进入应用
+func (a *CorpAdapter) OnEnterAgent(h func(ctx context.Context, req *types.CloudRequest, event *corp.ReqEnterAgentEvent) (interface{}, error)) {
+	a.handlers[eventKey(corp.EventTypeEnterAgent)] = bind(corp.GetEnterAgentEvent, h)
+}
+
+func corpRoute(head messageHead) string {
+	if head.MsgType != corp.MsgTypeEvent {
+		return messageKey(head.MsgType)
+	}
+	return eventKey(head.Event)
+}
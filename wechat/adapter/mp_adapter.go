@@ -0,0 +1,185 @@
+package adapter
+
+import (
+	"context"
+	"strings"
+
+	types "github.com/skynology/cloud-types"
+	"github.com/skynology/cloud-types/wechat/mp"
+)
+
+// 公众号消息适配器.
+// 将 CloudRequest.ExtraData 中微信推送的 XML 解析为 mp 包中对应的类型并调用处理函数,
+// 处理函数返回的 Res* 回复编码后写入 CloudeResponse.ExtraData:
+//
+//	a := adapter.NewMPAdapter()
+//	a.OnText(func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqText) (interface{}, error) {
+//		return adapter.NewMPReply(ctx, &msg.CommonMessageHeader).Text(msg.Content), nil
+//	})
+//	registry.Define("wechat", a.Serve)
+type MPAdapter struct {
+	adapter
+}
+
+func NewMPAdapter() *MPAdapter {
+	return &MPAdapter{adapter: newAdapter()}
+}
+
+// 处理云函数调用, 签名与 types.CloudFunc 一致
+func (a *MPAdapter) Serve(ctx context.Context, req *types.CloudRequest) *types.CloudeResponse {
+	return a.serve(ctx, req, a.route)
+}
+
+// 没有对应处理函数的消息及事件, header 为消息头
+func (a *MPAdapter) OnDefault(h func(ctx context.Context, req *types.CloudRequest, header *mp.CommonMessageHeader) (interface{}, error)) {
+	a.fallback = bind(func(data string) (*mp.CommonMessageHeader, error) {
+		var header struct {
+			XMLName struct{} `xml:"xml"`
+			mp.CommonMessageHeader
+		}
+		err := mp.UnmarshalXML([]byte(data), &header)
+		return &header.CommonMessageHeader, err
+	}, h)
+}
+
+// 文本消息
+func (a *MPAdapter) OnText(h func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqText) (interface{}, error)) {
+	a.handlers[messageKey(mp.MsgTypeText)] = bind(mp.GetText, h)
+}
+
+// 图片消息
+func (a *MPAdapter) OnImage(h func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqImage) (interface{}, error)) {
+	a.handlers[messageKey(mp.MsgTypeImage)] = bind(mp.GetImage, h)
+}
+
+// 语音消息
+func (a *MPAdapter) OnVoice(h func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqVoice) (interface{}, error)) {
+	a.handlers[messageKey(mp.MsgTypeVoice)] = bind(mp.GetVoice, h)
+}
+
+// 视频消息
+func (a *MPAdapter) OnVideo(h func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqVideo) (interface{}, error)) {
+	a.handlers[messageKey(mp.MsgTypeVideo)] = bind(mp.GetVideo, h)
+}
+
+// 地理位置消息
+func (a *MPAdapter) OnLocation(h func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqLocation) (interface{}, error)) {
+	a.handlers[messageKey(mp.MsgTypeLocation)] = bind(mp.GetLocation, h)
+}
+
+// 链接消息
+func (a *MPAdapter) OnLink(h func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqLink) (interface{}, error)) {
+	a.handlers[messageKey(mp.MsgTypeLink)] = bind(mp.GetLink, h)
+}
+
+// 关注事件(普通关注)
+func (a *MPAdapter) OnSubscribe(h func(ctx context.Context, req *types.CloudRequest, event *mp.ReqSubscribeEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeSubscribe)] = bind(mp.GetSubscribeEvent, h)
+}
+
+// 未关注用户扫描带参数二维码关注
+func (a *MPAdapter) OnSubscribeByScan(h func(ctx context.Context, req *types.CloudRequest, event *mp.ReqSubscribeByScanEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeSubscribe+scanSuffix)] = bind(mp.GetSubscribeByScanEvent, h)
+}
+
+// 取消关注
+func (a *MPAdapter) OnUnsubscribe(h func(ctx context.Context, req *types.CloudRequest, event *mp.ReqUnsubscribeEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeUnsubscribe)] = bind(mp.GetUnsubscribeEvent, h)
+}
+
+// 已关注用户扫描带参数二维码
+func (a *MPAdapter) OnScan(h func(ctx context.Context, req *types.CloudRequest, event *mp.ReqScanEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeScan)] = bind(mp.GetScanEvent, h)
+}
+
+// 上报地理位置事件
+func (a *MPAdapter) OnLocationEvent(h func(ctx context.Context, req *types.CloudRequest, event *mp.ReqLocationEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeLocation)] = bind(mp.GetLocationEvent, h)
+}
+
+// 点击菜单拉取消息
+func (a *MPAdapter) OnClick(h func(ctx context.Context, req *types.CloudRequest, event *mp.ClickEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeClick)] = bind(mp.GetClickEvent, h)
+}
+
+// 点击菜单跳转链接
+func (a *MPAdapter) OnView(h func(ctx context.Context, req *types.CloudRequest, event *mp.ViewEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeView)] = bind(mp.GetViewEvent, h)
+}
+
+// 扫码推事件
+func (a *MPAdapter) OnScanCodePush(h func(ctx context.Context, req *types.CloudRequest, event *mp.ScanCodePushEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeScanCodePush)] = bind(mp.GetScanCodePushEvent, h)
+}
+
+// 扫码推事件且弹出“消息接收中”提示框
+func (a *MPAdapter) OnScanCodeWaitMsg(h func(ctx context.Context, req *types.CloudRequest, event *mp.ScanCodeWaitMsgEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeScanCodeWaitMsg)] = bind(mp.GetScanCodeWaitMsgEvent, h)
+}
+
+// 弹出系统拍照发图
+func (a *MPAdapter) OnPicSysPhoto(h func(ctx context.Context, req *types.CloudRequest, event *mp.PicSysPhotoEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypePicSysPhoto)] = bind(mp.GetPicSysPhotoEvent, h)
+}
+
+// 弹出拍照或者相册发图
+func (a *MPAdapter) OnPicPhotoOrAlbum(h func(ctx context.Context, req *types.CloudRequest, event *mp.PicPhotoOrAlbumEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypePicPhotoOrAlbum)] = bind(mp.GetPicPhotoOrAlbumEvent, h)
+}
+
+// 弹出微信相册发图器
+func (a *MPAdapter) OnPicWeixin(h func(ctx context.Context, req *types.CloudRequest, event *mp.PicWeixinEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypePicWeixin)] = bind(mp.GetPicWeixinEvent, h)
+}
+
+// 弹出地理位置选择器
+func (a *MPAdapter) OnLocationSelect(h func(ctx context.Context, req *types.CloudRequest, event *mp.LocationSelectEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeLocationSelect)] = bind(mp.GetLocationSelectEvent, h)
+}
+
+// 卡券通过审核
+func (a *MPAdapter) OnCardPassCheck(h func(ctx context.Context, req *types.CloudRequest, event *mp.CardPassCheckEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeCardPassCheck)] = bind(mp.GetCardPassCheckEvent, h)
+}
+
+// 卡券未通过审核
+func (a *MPAdapter) OnCardNotPassCheck(h func(ctx context.Context, req *types.CloudRequest, event *mp.CardNotPassCheckEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeCardNotPassCheck)] = bind(mp.GetCardNotPassCheckEvent, h)
+}
+
+// 领取卡券
+func (a *MPAdapter) OnUserGetCard(h func(ctx context.Context, req *types.CloudRequest, event *mp.UserGetCardEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeUserGetCard)] = bind(mp.GetUserGetCardEvent, h)
+}
+
+// 删除卡券
+func (a *MPAdapter) OnUserDelCard(h func(ctx context.Context, req *types.CloudRequest, event *mp.UserDelCardEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeUserDelCard)] = bind(mp.GetUserDelCardEvent, h)
+}
+
+// 进入会员卡
+func (a *MPAdapter) OnUserViewCard(h func(ctx context.Context, req *types.CloudRequest, event *mp.UserViewCardEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeUserViewCard)] = bind(mp.GetUserViewCardEvent, h)
+}
+
+// 核销卡券
+func (a *MPAdapter) OnUserConsumeCard(h func(ctx context.Context, req *types.CloudRequest, event *mp.UserConsumeCardEvent) (interface{}, error)) {
+	a.handlers[eventKey(mp.EventTypeUserConsumeCard)] = bind(mp.GetUserConsumeCardEvent, h)
+}
+
+// 区分扫描带参数二维码关注与普通关注
+const scanSuffix = ":scan"
+
+// 扫描带参数二维码关注时, 没有设置 OnSubscribeByScan 则交给 OnSubscribe 处理
+func (a *MPAdapter) route(head messageHead) string {
+	if head.MsgType != mp.MsgTypeEvent {
+		return messageKey(head.MsgType)
+	}
+	if head.Event == mp.EventTypeSubscribe && strings.HasPrefix(head.EventKey, "qrscene_") {
+		key := eventKey(head.Event + scanSuffix)
+		if _, ok := a.handlers[key]; ok {
+			return key
+		}
+	}
+	return eventKey(head.Event)
+}
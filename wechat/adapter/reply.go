@@ -0,0 +1,87 @@
+package adapter
+
+import (
+	"context"
+
+	types "github.com/skynology/cloud-types"
+	"github.com/skynology/cloud-types/wechat/corp"
+	"github.com/skynology/cloud-types/wechat/mp"
+)
+
+// 当前时间戳, 取自 ctx 中的时钟(见 types.ClockFrom)
+func Timestamp(ctx context.Context) int64 {
+	return types.ClockFrom(ctx).Now().Unix()
+}
+
+// 公众号被动回复: 收发方与收到的消息相反, CreateTime 取自 ctx 中的时钟
+//
+//	a.OnText(func(ctx context.Context, req *types.CloudRequest, msg *mp.ReqText) (interface{}, error) {
+//		return adapter.NewMPReply(ctx, &msg.CommonMessageHeader).Text(msg.Content), nil
+//	})
+type MPReply struct {
+	to, from  string
+	timestamp int64
+}
+
+func NewMPReply(ctx context.Context, msg *mp.CommonMessageHeader) MPReply {
+	return MPReply{to: msg.FromUserName, from: msg.ToUserName, timestamp: Timestamp(ctx)}
+}
+
+func (r MPReply) Text(content string) *mp.ResText {
+	return mp.NewResText(r.to, r.from, r.timestamp, content)
+}
+
+func (r MPReply) Image(mediaId string) *mp.ResImage {
+	return mp.NewResImage(r.to, r.from, r.timestamp, mediaId)
+}
+
+func (r MPReply) Voice(mediaId string) *mp.ResVoice {
+	return mp.NewResVoice(r.to, r.from, r.timestamp, mediaId)
+}
+
+func (r MPReply) Video(mediaId, title, description string) *mp.ResVideo {
+	return mp.NewResVideo(r.to, r.from, r.timestamp, mediaId, title, description)
+}
+
+func (r MPReply) Music(thumbMediaId, musicURL, HQMusicURL, title, description string) *mp.ResMusic {
+	return mp.NewResMusic(r.to, r.from, r.timestamp, thumbMediaId, musicURL, HQMusicURL, title, description)
+}
+
+func (r MPReply) News(articles []mp.ResArticle) *mp.ResNews {
+	return mp.NewResNews(r.to, r.from, r.timestamp, articles)
+}
+
+// 转发到多客服, kfAccount 为空时由系统分配
+func (r MPReply) TransferToCustomerService(kfAccount string) *mp.TransferToCustomerService {
+	return mp.NewTransferToCustomerService(r.to, r.from, r.timestamp, kfAccount)
+}
+
+// 企业号被动回复: 收发方与收到的消息相反, CreateTime 取自 ctx 中的时钟
+type CorpReply struct {
+	to, from  string
+	timestamp int64
+}
+
+func NewCorpReply(ctx context.Context, msg *corp.CommonMessageHeader) CorpReply {
+	return CorpReply{to: msg.FromUserName, from: msg.ToUserName, timestamp: Timestamp(ctx)}
+}
+
+func (r CorpReply) Text(content string) *corp.ResText {
+	return corp.NewResText(r.to, r.from, r.timestamp, content)
+}
+
+func (r CorpReply) Image(mediaId string) *corp.ResImage {
+	return corp.NewResImage(r.to, r.from, r.timestamp, mediaId)
+}
+
+func (r CorpReply) Voice(mediaId string) *corp.ResVoice {
+	return corp.NewResVoice(r.to, r.from, r.timestamp, mediaId)
+}
+
+func (r CorpReply) Video(mediaId, title, description string) *corp.ResVideo {
+	return corp.NewResVideo(r.to, r.from, r.timestamp, mediaId, title, description)
+}
+
+func (r CorpReply) News(articles []corp.ResArticle) *corp.ResNews {
+	return corp.NewResNews(r.to, r.from, r.timestamp, articles)
+}
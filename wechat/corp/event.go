@@ -17,6 +17,8 @@ const (
 	EventTypePicPhotoOrAlbum = "pic_photo_or_album" // pic_photo_or_album：弹出拍照或者相册发图的事件推送
 	EventTypePicWeixin       = "pic_weixin"         // pic_weixin：弹出微信相册发图器的事件推送
 	EventTypeLocationSelect  = "location_select"    // location_select：弹出地理位置选择器的事件推送
+
+	EventTypeEnterAgent = "enter_agent" // 用户进入应用的事件推送
 )
 
 // 关注事件
@@ -0,0 +1,335 @@
+package types
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WebSocket 传输: API 服务器与云代码服务器之间保持一条长连接,
+// 在上面以 JSON-RPC 2.0 (见 jsonrpc.go) 复用并发的调用, 每条 WebSocket 消息为一条 JSON-RPC 消息.
+//
+// 云代码服务器一侧:
+//
+//	http.Handle("/ws", types.NewWebSocketServer(registry))
+//
+// API 服务器一侧:
+//
+//	client, err := types.DialWebSocket("ws://127.0.0.1:3000/ws", nil)
+//	res := client.Call(ctx, "createOrder", req)
+type WebSocketServer struct {
+	Handler Handler
+
+	// 每条连接上并发执行的调用数上限, 达到上限时新的调用排队等待.
+	// 排队期间连接照常读取, ping 及取消请求不受影响
+	MaxInFlight int
+
+	// 每条连接上排队等待的调用数上限, 超过时直接返回 RPCServerBusy 错误, 调用不会执行. 为 0 时按 1024
+	MaxQueued int
+
+	// 超过此时间没有收到任何消息(包括 ping)则断开连接, 应大于客户端的 PingInterval
+	IdleTimeout time.Duration
+}
+
+func NewWebSocketServer(h Handler) *WebSocketServer {
+	return &WebSocketServer{Handler: h, MaxInFlight: 64, MaxQueued: 1024, IdleTimeout: 45 * time.Second}
+}
+
+func (s *WebSocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := wsUpgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer conn.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	server := newRPCServer(s.Handler, func(msg *rpcMessage) error {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return conn.writeText(b)
+	})
+	server.setLimit(s.MaxInFlight)
+	// 不能阻塞读取, 否则 ping 得不到回复, 读超时也会断开连接
+	queued := s.MaxQueued
+	if queued <= 0 {
+		queued = 1024
+	}
+	server.setQueue(queued)
+
+	extend := func() {
+		if s.IdleTimeout > 0 {
+			conn.setReadDeadline(time.Now().Add(s.IdleTimeout))
+		}
+	}
+	extend()
+	for {
+		data, err := conn.readMessage(extend)
+		if err != nil {
+			// 连接断开后结果已无法送达, 取消进行中的调用
+			cancel()
+			server.wait()
+			return
+		}
+		var msg rpcMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			server.reply(nil, nil, &RPCError{Code: RPCParseError, Message: err.Error()})
+			continue
+		}
+		if server.handle(ctx, &msg) {
+			return
+		}
+	}
+}
+
+// API 服务器一侧的 WebSocket 客户端, 实现了 Handler.
+// 连接断开后自动重连; 断开期间的调用会等待重连成功或 ctx 结束.
+// 已发出但连接断开的调用返回错误, 不会自动重试, 以免重复执行.
+type WebSocketClient struct {
+	URL    string
+	Header http.Header
+
+	// 发送 ping 的间隔, 超过两个间隔没有收到任何消息则认为连接已断开
+	PingInterval time.Duration
+
+	// 并发调用数上限, 达到上限时新的调用等待
+	MaxInFlight int
+
+	// 重连的最长等待时间, 重连间隔从 100ms 开始加倍直到此值
+	MaxReconnectWait time.Duration
+
+	// 建立连接的超时时间
+	DialTimeout time.Duration
+
+	sem chan struct{}
+
+	mu      sync.Mutex
+	started bool
+	session *wsSession
+	ready   chan struct{} // 连接建立后关闭
+	closed  chan struct{}
+}
+
+type wsSession struct {
+	conn *wsConn
+	rpc  *rpcClient
+}
+
+// 连接云代码服务器, 首次连接失败时返回错误
+func DialWebSocket(rawurl string, header http.Header) (*WebSocketClient, error) {
+	c := NewWebSocketClient(rawurl, header)
+	if err := c.Start(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// 创建客户端但不连接, 修改配置后调用 Start
+func NewWebSocketClient(rawurl string, header http.Header) *WebSocketClient {
+	return &WebSocketClient{
+		URL:              rawurl,
+		Header:           header,
+		PingInterval:     15 * time.Second,
+		MaxInFlight:      256,
+		MaxReconnectWait: 10 * time.Second,
+		DialTimeout:      10 * time.Second,
+		ready:            make(chan struct{}),
+		closed:           make(chan struct{}),
+	}
+}
+
+// 建立首次连接并开始维护连接, 之后断开会自动重连
+func (c *WebSocketClient) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.started {
+		return nil
+	}
+	session, err := c.connect()
+	if err != nil {
+		return err
+	}
+	if c.MaxInFlight > 0 {
+		c.sem = make(chan struct{}, c.MaxInFlight)
+	}
+	c.started = true
+	c.session = session
+	close(c.ready)
+	go c.maintain(session)
+	return nil
+}
+
+func (c *WebSocketClient) connect() (*wsSession, error) {
+	conn, err := wsDial(c.URL, c.Header, c.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	s := &wsSession{conn: conn}
+	s.rpc = newRPCClient(func(msg *rpcMessage) error {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		return conn.writeText(b)
+	})
+
+	var (
+		lastMu   sync.Mutex
+		lastSeen = time.Now()
+	)
+	seen := func() {
+		lastMu.Lock()
+		lastSeen = time.Now()
+		lastMu.Unlock()
+	}
+
+	// 读取回复
+	go func() {
+		for {
+			data, err := conn.readMessage(seen)
+			if err != nil {
+				s.rpc.fail(err)
+				conn.close()
+				return
+			}
+			var msg rpcMessage
+			if json.Unmarshal(data, &msg) == nil {
+				s.rpc.deliver(&msg)
+			}
+		}
+	}()
+
+	// 心跳
+	if interval := c.PingInterval; interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					lastMu.Lock()
+					idle := time.Since(lastSeen)
+					lastMu.Unlock()
+					if idle > 2*interval || conn.ping() != nil {
+						s.rpc.fail(errRPCClosed)
+						conn.close()
+						return
+					}
+				case <-s.rpc.done:
+					return
+				}
+			}
+		}()
+	}
+	return s, nil
+}
+
+func (c *WebSocketClient) setSession(s *wsSession) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.session = s
+	if s != nil {
+		close(c.ready)
+	} else {
+		c.ready = make(chan struct{})
+	}
+}
+
+// 连接断开后重连, 直到 Close
+func (c *WebSocketClient) maintain(s *wsSession) {
+	for {
+		select {
+		case <-s.rpc.done:
+		case <-c.closed:
+			return
+		}
+		c.setSession(nil)
+
+		wait := 100 * time.Millisecond
+		for {
+			select {
+			case <-time.After(wait):
+			case <-c.closed:
+				return
+			}
+			next, err := c.connect()
+			if err == nil {
+				s = next
+				c.setSession(s)
+				break
+			}
+			if wait *= 2; c.MaxReconnectWait > 0 && wait > c.MaxReconnectWait {
+				wait = c.MaxReconnectWait
+			}
+		}
+	}
+}
+
+// 等待可用的连接
+func (c *WebSocketClient) current(ctx context.Context) (*wsSession, error) {
+	for {
+		c.mu.Lock()
+		s, ready := c.session, c.ready
+		c.mu.Unlock()
+		if s != nil {
+			return s, nil
+		}
+		select {
+		case <-ready:
+		case <-c.closed:
+			return nil, errRPCClosed
+		case <-ctx.Done():
+			return nil, CloudError{Code: ErrCodeTimeout, Message: ctx.Err().Error()}
+		}
+	}
+}
+
+// 调用目标, 返回的错误为传输层错误; 云代码的失败在 CloudeResponse 中
+func (c *WebSocketClient) Invoke(ctx context.Context, t Target, req *CloudRequest) (*CloudeResponse, error) {
+	if c.sem != nil {
+		select {
+		case c.sem <- struct{}{}:
+			defer func() { <-c.sem }()
+		case <-ctx.Done():
+			return nil, CloudError{Code: ErrCodeTimeout, Message: ctx.Err().Error()}
+		}
+	}
+	s, err := c.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.rpc.invoke(ctx, t, req)
+}
+
+func (c *WebSocketClient) Call(ctx context.Context, name string, req *CloudRequest) *CloudeResponse {
+	return responseOrFail(c.Invoke(ctx, FunctionTarget(name), req))
+}
+
+func (c *WebSocketClient) RunHook(ctx context.Context, className string, hook HookType, req *CloudRequest) *CloudeResponse {
+	return responseOrFail(c.Invoke(ctx, HookTarget(className, hook), req))
+}
+
+// 关闭连接, 不再重连
+func (c *WebSocketClient) Close() error {
+	c.mu.Lock()
+	select {
+	case <-c.closed:
+		c.mu.Unlock()
+		return nil
+	default:
+	}
+	close(c.closed)
+	s := c.session
+	c.mu.Unlock()
+
+	if s != nil {
+		s.rpc.fail(errRPCClosed)
+		return s.conn.close()
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package types
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 启动本地 WebSocket 服务器, 返回 ws:// 地址
+func startWebSocketServer(t *testing.T, h http.Handler) string {
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func dialWebSocketClient(t *testing.T, url string, setup func(c *WebSocketClient)) *WebSocketClient {
+	c := NewWebSocketClient(url, nil)
+	if setup != nil {
+		setup(c)
+	}
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func sleepRegistry(d time.Duration, running, peak *int32) *Registry {
+	r := NewRegistry()
+	r.Define("sleep", func(ctx context.Context, req *CloudRequest) *CloudeResponse {
+		n := atomic.AddInt32(running, 1)
+		defer atomic.AddInt32(running, -1)
+		for {
+			p := atomic.LoadInt32(peak)
+			if n <= p || atomic.CompareAndSwapInt32(peak, p, n) {
+				break
+			}
+		}
+		select {
+		case <-time.After(d):
+		case <-ctx.Done():
+			return Fail(ErrCodeTimeout, ctx.Err().Error())
+		}
+		return &CloudeResponse{Successed: true, Result: req.Data["i"]}
+	})
+	return r
+}
+
+func TestWebSocketRoundTrip(t *testing.T) {
+	var running, peak int32
+	url := startWebSocketServer(t, NewWebSocketServer(sleepRegistry(10*time.Millisecond, &running, &peak)))
+	c := dialWebSocketClient(t, url, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := c.Call(context.Background(), "sleep", &CloudRequest{Data: map[string]interface{}{"i": i}})
+			if !res.Successed || res.Result != float64(i) {
+				t.Errorf("调用 %d: %+v", i, res)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+// 达到 MaxInFlight 时调用排队, 执行时间超过心跳超时也不会断开连接
+func TestWebSocketBackPressure(t *testing.T) {
+	var running, peak int32
+	server := NewWebSocketServer(sleepRegistry(800*time.Millisecond, &running, &peak))
+	server.MaxInFlight = 1
+	server.IdleTimeout = 500 * time.Millisecond
+	url := startWebSocketServer(t, server)
+	c := dialWebSocketClient(t, url, func(c *WebSocketClient) {
+		c.PingInterval = 200 * time.Millisecond
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res := c.Call(context.Background(), "sleep", &CloudRequest{Data: map[string]interface{}{"i": i}})
+			if !res.Successed {
+				t.Errorf("调用 %d 失败: %s", i, res.Errors.Message)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if p := atomic.LoadInt32(&peak); p != 1 {
+		t.Errorf("并发执行数为 %d, 应为 1", p)
+	}
+}
+
+func TestWebSocketServerBusy(t *testing.T) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	r := NewRegistry()
+	r.Define("block", func(ctx context.Context, req *CloudRequest) *CloudeResponse {
+		started <- struct{}{}
+		<-release
+		return &CloudeResponse{Successed: true}
+	})
+	server := NewWebSocketServer(r)
+	server.MaxInFlight = 1
+	server.MaxQueued = 1
+	url := startWebSocketServer(t, server)
+	c := dialWebSocketClient(t, url, nil)
+
+	call := func(results chan<- *CloudeResponse) {
+		results <- c.Call(context.Background(), "block", &CloudRequest{})
+	}
+	first := make(chan *CloudeResponse, 1)
+	go call(first)
+	<-started
+
+	// 一个排队, 另一个超出排队上限立即返回繁忙
+	rest := make(chan *CloudeResponse, 2)
+	go call(rest)
+	go call(rest)
+	busy := <-rest
+	if busy.Successed || !strings.Contains(busy.Errors.Message, "服务器繁忙") {
+		t.Fatalf("超出排队上限的调用应返回繁忙: %+v", busy)
+	}
+	close(release)
+	if res := <-first; !res.Successed {
+		t.Fatalf("执行中的调用应成功: %+v", res.Errors)
+	}
+	if res := <-rest; !res.Successed {
+		t.Fatalf("排队的调用应成功: %+v", res.Errors)
+	}
+}
+
+// 空闲时间超过服务端 IdleTimeout, 心跳保持连接
+func TestWebSocketHeartbeat(t *testing.T) {
+	var running, peak int32
+	server := NewWebSocketServer(sleepRegistry(0, &running, &peak))
+	server.IdleTimeout = 300 * time.Millisecond
+	url := startWebSocketServer(t, server)
+	c := dialWebSocketClient(t, url, func(c *WebSocketClient) {
+		c.PingInterval = 100 * time.Millisecond
+	})
+
+	c.mu.Lock()
+	before := c.session
+	c.mu.Unlock()
+	// 连接断开时 done 被关闭
+	select {
+	case <-before.rpc.done:
+		t.Fatal("连接被断开")
+	case <-time.After(3 * server.IdleTimeout):
+	}
+	if res := c.Call(context.Background(), "sleep", &CloudRequest{}); !res.Successed {
+		t.Fatal(res.Errors)
+	}
+	c.mu.Lock()
+	after := c.session
+	c.mu.Unlock()
+	if before != after {
+		t.Fatal("连接被重建")
+	}
+}
+
+// 对端不再回复时, 进行中的调用在心跳超时后返回错误
+func TestWebSocketDeadPeer(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	url := startWebSocketServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := wsUpgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer conn.close()
+		<-block
+	}))
+	c := dialWebSocketClient(t, url, func(c *WebSocketClient) {
+		c.PingInterval = 50 * time.Millisecond
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	res := c.Call(ctx, "sleep", &CloudRequest{})
+	if res.Successed || res.Errors.Code == ErrCodeTimeout {
+		t.Fatalf("应在心跳超时后返回连接错误: %+v", res)
+	}
+}
+
+func TestWebSocketReconnect(t *testing.T) {
+	var running, peak int32
+	url := startWebSocketServer(t, NewWebSocketServer(sleepRegistry(0, &running, &peak)))
+	c := dialWebSocketClient(t, url, nil)
+	if res := c.Call(context.Background(), "sleep", &CloudRequest{}); !res.Successed {
+		t.Fatal(res.Errors)
+	}
+
+	// 直接断开底层连接, 模拟网络故障
+	c.mu.Lock()
+	c.session.conn.conn.Close()
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		res := c.Call(ctx, "sleep", &CloudRequest{})
+		if res.Successed {
+			break
+		}
+		if ctx.Err() != nil {
+			t.Fatalf("未能重连: %s", res.Errors.Message)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	c.Close()
+	if res := c.Call(context.Background(), "sleep", &CloudRequest{}); res.Successed {
+		t.Fatal("关闭后的调用应失败")
+	}
+}
+
+// 服务端拒绝没有掩码的客户端帧
+func TestWebSocketUnmaskedFrame(t *testing.T) {
+	var running, peak int32
+	url := startWebSocketServer(t, NewWebSocketServer(sleepRegistry(0, &running, &peak)))
+	conn, err := wsDial(url, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.close()
+	conn.client = false
+	if err := conn.writeText([]byte(`{"jsonrpc":"2.0","id":1,"method":"functions/sleep"}`)); err != nil {
+		t.Fatal(err)
+	}
+	conn.setReadDeadline(time.Now().Add(2 * time.Second))
+	if data, err := conn.readMessage(nil); err == nil {
+		t.Fatalf("连接应被关闭, 收到: %s", data)
+	}
+}